@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+type ServiceSummary struct {
+	Valid   int `json:"valid"`
+	Invalid int `json:"invalid"`
+	Errored int `json:"errored"`
+}
+
+type BatchSummary struct {
+	Total       int                        `json:"total"`
+	Valid       int                        `json:"valid"`
+	Invalid     int                        `json:"invalid"`
+	Errored     int                        `json:"errored"`
+	Skipped     int                        `json:"skipped"`
+	SkippedRows []string                   `json:"skipped_rows,omitempty"`
+	Slow        int                        `json:"slow,omitempty"`
+	Deduped     int                        `json:"deduped,omitempty"`
+	Stopped     string                     `json:"stopped,omitempty"`
+	Severities  map[string]int             `json:"severities,omitempty"`
+	Services    map[string]*ServiceSummary `json:"services,omitempty"`
+}
+
+type BatchResult struct {
+	Version    string               `json:"version"`
+	StartedAt  string               `json:"started_at"`
+	FinishedAt string               `json:"finished_at"`
+	Summary    BatchSummary         `json:"summary"`
+	Results    []VerificationResult `json:"results"`
+}
+
+type batchResult struct {
+	index  int
+	result VerificationResult
+}
+
+type batchJob struct {
+	service string
+	key     string
+	secret  string
+	err     string
+	skip    string
+}
+
+func batchMode() bool {
+	return opts.file != "" || opts.all || len(opts.keys) > 1
+}
+
+func loadBatchJobs() ([]batchJob, error) {
+	var jobs []batchJob
+	if opts.all {
+		names := make([]string, 0, len(servicesConfig.Services))
+		for name := range servicesConfig.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if opts.jitter > 0 {
+			rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+		}
+		for _, key := range opts.keys {
+			for _, name := range names {
+				if serviceAllowed(name) {
+					jobs = append(jobs, batchJob{service: name, key: key, secret: opts.secret})
+				}
+			}
+		}
+		return jobs, nil
+	}
+	if opts.file == "" {
+		for _, key := range opts.keys {
+			jobs = append(jobs, batchJob{service: opts.service, key: key, secret: opts.secret})
+		}
+		return jobs, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if opts.file != "-" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	if strings.EqualFold(filepath.Ext(opts.file), ".csv") {
+		return loadCSVJobs(r)
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		service, key := opts.service, line
+		if service == "" {
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				jobs = append(jobs, batchJob{service: "input", key: line, err: fmt.Sprintf("line %d: expected service:key", lineNum)})
+				continue
+			}
+			service, key = parts[0], parts[1]
+		}
+		if !serviceAllowed(service) {
+			continue
+		}
+		jobs = append(jobs, batchJob{service: service, key: key, secret: opts.secret})
+		if opts.count > 0 && len(jobs) >= opts.count {
+			break
+		}
+	}
+	return jobs, scanner.Err()
+}
+
+func parseServiceList(value string) map[string]bool {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	services := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = resolveService(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, exists := servicesConfig.Services[name]; !exists {
+			log.Warn("unknown service in filter", "service", name)
+		}
+		services[name] = true
+	}
+	return services
+}
+
+func parseTags(value string) map[string]bool {
+	tags := make(map[string]bool)
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags[tag] = true
+		}
+	}
+	return tags
+}
+
+func serviceTagged(serviceConfig ServiceConfig) bool {
+	if len(opts.tags) == 0 {
+		return true
+	}
+	for _, tag := range serviceConfig.Tags {
+		if opts.tags[strings.ToLower(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+func serviceAllowed(name string) bool {
+	name = resolveService(name)
+	if opts.skip[name] || !serviceTagged(servicesConfig.Services[name]) {
+		return false
+	}
+	return len(opts.only) == 0 || opts.only[name]
+}
+
+func runBatch(ctx context.Context) []VerificationResult {
+	started := time.Now()
+	jobs, err := loadBatchJobs()
+	if err != nil {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to load keys: "+err.Error()))
+		os.Exit(1)
+	}
+
+	pending, owners := jobs, [][]int(nil)
+	if opts.dedupe {
+		pending, owners = dedupeJobs(jobs)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resultCh := verifyJobs(ctx, pending, opts.concurrency)
+
+	if !opts.jsonOutput && !opts.summaryOnly {
+		fmt.Println()
+	}
+
+	results := make([]VerificationResult, len(jobs))
+	done := make([]bool, len(jobs))
+	stopReason := ""
+	progress := newBatchProgress(len(pending))
+	for br := range resultCh {
+		progress.clear()
+		indexes := []int{br.index}
+		if owners != nil {
+			indexes = owners[br.index]
+		}
+		for _, index := range indexes {
+			results[index] = br.result
+			done[index] = true
+		}
+		if pending[br.index].err == "" && pending[br.index].skip == "" {
+			recordResult(br.result, pending[br.index].key)
+		}
+		if !opts.jsonOutput && !opts.summaryOnly && opts.sortBy == "" && meetsSeverity(br.result) {
+			displayBatchResult(br.result)
+		}
+		progress.add(br.result)
+		if opts.failFast && !br.result.Valid && !br.result.Skipped && stopReason == "" {
+			stopReason = "stopped at first invalid key (-fail-fast)"
+			cancel()
+		}
+	}
+	progress.clear()
+	if stopReason == "" && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		stopReason = "time budget exceeded (-timeout-total)"
+	}
+	if stopReason == "" && requestBudgetSpent() {
+		stopReason = "request budget exhausted (-max-requests)"
+	}
+
+	for i, job := range jobs {
+		if !done[i] {
+			results[i] = VerificationResult{
+				Service:   resultService(job.service),
+				Key:       maskKey(job.key),
+				ID:        keyID(normalizeKey(job.key, false)),
+				Message:   "skipped",
+				Skipped:   true,
+				Timestamp: time.Now().Format(time.RFC3339),
+			}
+		}
+	}
+
+	if opts.sortBy != "" {
+		sortResults(results, opts.sortBy)
+		if !opts.jsonOutput && !opts.summaryOnly {
+			for _, result := range results {
+				if (!result.Skipped || result.ReasonCode != "") && meetsSeverity(result) {
+					displayBatchResult(result)
+				}
+			}
+		}
+	}
+
+	summary := summarize(results, stopReason)
+	summary.Deduped = len(jobs) - len(pending)
+	switch {
+	case opts.jsonOutput && opts.diff != "":
+	case opts.jsonOutput && opts.summaryOnly:
+		writeJSON(summary)
+	case opts.jsonOutput && opts.minSeverity != "":
+		shown := []VerificationResult{}
+		for _, result := range results {
+			if meetsSeverity(result) {
+				shown = append(shown, result)
+			}
+		}
+		writeJSON(newBatchResult(started, shown, summary))
+	case opts.jsonOutput:
+		writeJSON(newBatchResult(started, results, summary))
+	default:
+		displaySummary(summary)
+	}
+	reportRun(results)
+	return results
+}
+
+func newBatchResult(started time.Time, results []VerificationResult, summary BatchSummary) BatchResult {
+	return BatchResult{
+		Version:    version,
+		StartedAt:  started.Format(time.RFC3339),
+		FinishedAt: time.Now().Format(time.RFC3339),
+		Summary:    summary,
+		Results:    results,
+	}
+}
+
+func dedupeJobs(jobs []batchJob) ([]batchJob, [][]int) {
+	var unique []batchJob
+	var owners [][]int
+	seen := make(map[string]int)
+	canonical := make(map[string]string)
+	for i, job := range jobs {
+		if job.err != "" {
+			unique = append(unique, job)
+			owners = append(owners, []int{i})
+			continue
+		}
+		service, ok := canonical[job.service]
+		if !ok {
+			service = resolveService(job.service)
+			canonical[job.service] = service
+		}
+		id := service + "\x00" + strings.TrimSpace(job.key) + "\x00" + strings.TrimSpace(job.secret) + "\x00" + job.skip
+		if u, ok := seen[id]; ok {
+			owners[u] = append(owners[u], i)
+			continue
+		}
+		seen[id] = len(unique)
+		unique = append(unique, job)
+		owners = append(owners, []int{i})
+	}
+	return unique, owners
+}
+
+func resultService(name string) string {
+	if serviceConfig, exists := servicesConfig.Services[resolveService(name)]; exists {
+		return strings.ToLower(serviceConfig.Name)
+	}
+	return strings.ToLower(name)
+}
+
+func verifyJob(ctx context.Context, job batchJob) (result VerificationResult) {
+	if job.err != "" {
+		return VerificationResult{
+			Service:    resultService(job.service),
+			Key:        maskKey(job.key),
+			Message:    job.err,
+			Errored:    true,
+			ReasonCode: "bad_input",
+			Timestamp:  time.Now().Format(time.RFC3339),
+		}
+	}
+	if job.skip != "" {
+		return VerificationResult{
+			Service:    resultService(job.service),
+			Key:        maskKey(job.key),
+			Message:    "skipped: " + job.skip,
+			Skipped:    true,
+			ReasonCode: "bad_row",
+			Timestamp:  time.Now().Format(time.RFC3339),
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result = VerificationResult{
+				Service:    resultService(job.service),
+				Key:        maskKey(job.key),
+				Message:    fmt.Sprintf("verification failed: %v", r),
+				Errored:    true,
+				ReasonCode: "verify_panic",
+				Timestamp:  time.Now().Format(time.RFC3339),
+			}
+		}
+	}()
+	started := time.Now()
+	result = verifyAPIKey(ctx, job.service, job.key, job.secret)
+	result.LatencyMS = time.Since(started).Milliseconds()
+	return result
+}
+
+func verifyJobs(ctx context.Context, jobs []batchJob, concurrency int) <-chan batchResult {
+	jobCh := make(chan int)
+	resultCh := make(chan batchResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobCh {
+				if !sleepJitter(ctx) {
+					continue
+				}
+				result := verifyJob(ctx, jobs[index])
+				if ctx.Err() != nil && !result.Valid {
+					continue
+				}
+				resultCh <- batchResult{index: index, result: result}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobCh)
+		for index := range jobs {
+			select {
+			case jobCh <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	return resultCh
+}
+
+func sleepJitter(ctx context.Context) bool {
+	if opts.jitter <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(time.Duration(rand.Int63n(int64(opts.jitter)))):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func displayBatchResult(result VerificationResult) {
+	if opts.formatTmpl != nil {
+		displayFormatted(result)
+		return
+	}
+	mark := errorStyle.Render("✗")
+	info := result.Message
+	if result.Valid {
+		mark = successStyle.Render("✓")
+		info = result.Details
+	}
+
+	line := fmt.Sprintf("%s %s", mark, strings.ToLower(result.Service))
+	if result.Key != "" {
+		line += " " + dimStyle.Render(result.Key)
+	}
+	if result.ID != "" {
+		line += " " + dimStyle.Render("["+result.ID+"]")
+	}
+	if info != "" {
+		line += " " + dimStyle.Render(strings.ToLower(info))
+	}
+	if result.Valid && result.Mode != "" {
+		line += " " + modeStyle(result.Mode).Render("["+result.Mode+"]")
+	}
+	if result.Region != "" {
+		line += " " + dimStyle.Render("region: "+result.Region)
+	}
+	if result.Severity != "" {
+		line += " " + severityStyle(result.Severity).Render(result.Severity)
+	}
+	if result.ExpiringSoon {
+		line += " " + warnStyle.Render("⚠ "+expiryWarning(result))
+	}
+	if result.Warning != "" {
+		line += " " + warnStyle.Render("⚠ "+result.Warning)
+	}
+	fmt.Println(line)
+	if result.Reason != "" {
+		fmt.Printf("  %s\n", dimStyle.Render("why: "+result.Reason))
+	}
+}
+
+func summarize(results []VerificationResult, stopReason string) BatchSummary {
+	summary := BatchSummary{
+		Total:    len(results),
+		Stopped:  stopReason,
+		Services: make(map[string]*ServiceSummary),
+	}
+	for _, result := range results {
+		if result.Skipped {
+			summary.Skipped++
+			if result.ReasonCode == "bad_row" {
+				summary.SkippedRows = append(summary.SkippedRows, strings.TrimPrefix(result.Message, "skipped: "))
+			}
+			continue
+		}
+		if result.Warning != "" {
+			summary.Slow++
+		}
+		tally, ok := summary.Services[result.Service]
+		if !ok {
+			tally = &ServiceSummary{}
+			summary.Services[result.Service] = tally
+		}
+		switch {
+		case result.Valid:
+			summary.Valid++
+			tally.Valid++
+			if result.Severity != "" {
+				if summary.Severities == nil {
+					summary.Severities = make(map[string]int)
+				}
+				summary.Severities[result.Severity]++
+			}
+		case result.Errored:
+			summary.Errored++
+			tally.Errored++
+		default:
+			summary.Invalid++
+			tally.Invalid++
+		}
+	}
+	return summary
+}
+
+func displaySummary(summary BatchSummary) {
+	fmt.Println()
+	line := fmt.Sprintf("%d total, %d valid, %d invalid, %d errored", summary.Total, summary.Valid, summary.Invalid, summary.Errored)
+	if summary.Skipped > 0 {
+		line += fmt.Sprintf(", %d skipped", summary.Skipped)
+	}
+	if summary.Deduped > 0 {
+		line += fmt.Sprintf(", %d deduplicated", summary.Deduped)
+	}
+	if summary.Slow > 0 {
+		line += fmt.Sprintf(", %d slow", summary.Slow)
+	}
+	fmt.Printf("%s %s\n", highlightStyle.Render("summary:"), dimStyle.Render(line))
+	if len(summary.Severities) > 0 {
+		var counts []string
+		for i := len(severityLevels) - 1; i >= 0; i-- {
+			if n := summary.Severities[severityLevels[i]]; n > 0 {
+				counts = append(counts, severityStyle(severityLevels[i]).Render(fmt.Sprintf("%d %s", n, severityLevels[i])))
+			}
+		}
+		fmt.Printf("  %s %s\n", dimStyle.Render("valid by severity:"), strings.Join(counts, dimStyle.Render(", ")))
+	}
+	if summary.Stopped != "" {
+		fmt.Printf("  %s\n", dimStyle.Render("scan cut short: "+summary.Stopped))
+	}
+	for _, row := range summary.SkippedRows {
+		fmt.Printf("  %s\n", dimStyle.Render("skipped "+row))
+	}
+
+	if opts.summaryOnly && len(summary.Services) > 0 {
+		names := make([]string, 0, len(summary.Services))
+		width := 0
+		for name := range summary.Services {
+			names = append(names, name)
+			if len(name) > width {
+				width = len(name)
+			}
+		}
+		sort.Strings(names)
+
+		fmt.Println()
+		for _, name := range names {
+			tally := summary.Services[name]
+			counts := fmt.Sprintf("%d valid, %d invalid, %d errored", tally.Valid, tally.Invalid, tally.Errored)
+			mark := dimStyle.Render("•")
+			if tally.Valid > 0 {
+				mark = successStyle.Render("•")
+			}
+			fmt.Printf("  %s %-*s %s\n", mark, width, name, dimStyle.Render(counts))
+		}
+	}
+	fmt.Println()
+}
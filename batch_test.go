@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+func TestBatchResultSchema(t *testing.T) {
+	f, err := os.Open("results.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	if err := compiler.AddResource("results.schema.json", f); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compiler.Compile("results.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	full := VerificationResult{
+		Service:      "github",
+		Key:          maskKey("ghp_0123456789abcdefghij"),
+		ID:           keyID("ghp_0123456789abcdefghij"),
+		Secret:       maskKey("secret-0123456789"),
+		Valid:        true,
+		Message:      "valid",
+		Details:      "user: octocat",
+		Scopes:       []string{"repo", "admin:org"},
+		Endpoint:     "api.github.com",
+		Errored:      true,
+		Skipped:      true,
+		ExpiresAt:    now,
+		ExpiringSoon: true,
+		Reason:       "http 200 matched and the response has login",
+		ReasonCode:   "data_fields_present",
+		Mode:         "live",
+		Region:       "eu",
+		Severity:     "high",
+		Request:      &RequestInfo{Method: "GET", URL: "https://api.github.com/user", Headers: []string{"Authorization"}},
+		Warning:      "slow response: 3s (max_latency 2s)",
+		LatencyMS:    3000,
+		Timestamp:    now,
+	}
+	value := reflect.ValueOf(full)
+	for i := 0; i < value.NumField(); i++ {
+		if field := value.Type().Field(i); field.IsExported() && value.Field(i).IsZero() {
+			t.Fatalf("set VerificationResult.%s so the schema covers it", field.Name)
+		}
+	}
+
+	results := []VerificationResult{
+		full,
+		{Service: "github", Valid: true, Message: "valid", Severity: "critical", Warning: "slow response: 3s (max_latency 2s)", Timestamp: now},
+		{Service: "slack", Message: "request failed", Errored: true, ReasonCode: "request_failed", Timestamp: now},
+		{Service: "stripe", Key: "****", Message: "invalid (http 401)", ReasonCode: "status_mismatch", Timestamp: now},
+		{Service: "input", Message: "skipped: line 4: missing key", Skipped: true, ReasonCode: "bad_row", Timestamp: now},
+	}
+	summary := summarize(results, "stopped at first invalid key (-fail-fast)")
+	summary.Deduped = 1
+	value = reflect.ValueOf(summary)
+	for i := 0; i < value.NumField(); i++ {
+		if value.Field(i).IsZero() {
+			t.Fatalf("no test result sets BatchSummary.%s", value.Type().Field(i).Name)
+		}
+	}
+	doc := newBatchResult(time.Now().Add(-time.Minute), results, summary)
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var instance interface{}
+	if err := json.Unmarshal(data, &instance); err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validate(instance); err != nil {
+		t.Fatalf("batch json does not match results.schema.json: %v", err)
+	}
+}
+
+func TestResultServiceCanonical(t *testing.T) {
+	for _, name := range []string{"gitlab", "GitLab", "gl"} {
+		if got := resultService(name); got != "gitlab" {
+			t.Errorf("resultService(%q) = %q, want gitlab", name, got)
+		}
+	}
+	if got := resultService("NoSuchService"); got != "nosuchservice" {
+		t.Errorf("resultService(NoSuchService) = %q, want nosuchservice", got)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strings"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+type keyValidator func(key string) (string, error)
+
+var keyValidators = map[string]keyValidator{
+	"aws":               validateAWSKey,
+	"github":            validateGitHubKey,
+	"githubaccesstoken": validateGitHubKey,
+	"npm":               validateCRC32Token("npm_"),
+	"stripe":            validatePattern(`^(sk|rk|pk)_(live|test)_[0-9A-Za-z]{24,}$`, "stripe secret, restricted or publishable key"),
+	"slack":             validatePattern(`^xox[abposer]-[0-9A-Za-z-]{10,}$`, "slack token"),
+	"gitlab":            validatePattern(`^gl(pat|oas|dt|rt|ptt|ft|cbt|soat)-[0-9A-Za-z_.-]{20,}$`, "gitlab token"),
+	"openai":            validatePattern(`^sk-(proj-|svcacct-|admin-)?[0-9A-Za-z_-]{20,}$`, "openai key"),
+	"sendgrid":          validatePattern(`^SG\.[0-9A-Za-z_-]{22}\.[0-9A-Za-z_-]{43}$`, "sendgrid key"),
+	"huggingface":       validatePattern(`^hf_[0-9A-Za-z]{34}$`, "hugging face token"),
+}
+
+func verifyOffline(service, key string, result VerificationResult) VerificationResult {
+	validator, ok := keyValidators[strings.ToLower(service)]
+	if !ok {
+		result.Valid = false
+		result.Errored = true
+		result.Message = "no offline check for this service"
+		return result
+	}
+
+	details, err := validator(key)
+	if err != nil {
+		result.Valid = false
+		result.Message = "malformed key: " + err.Error()
+		return result
+	}
+	result.Valid = true
+	result.Message = "structurally valid, not confirmed"
+	result.Details = "not confirmed, " + details
+	return result
+}
+
+func validatePattern(pattern, label string) keyValidator {
+	re := regexp.MustCompile(pattern)
+	return func(key string) (string, error) {
+		if !re.MatchString(key) {
+			return "", fmt.Errorf("does not match the %s format", label)
+		}
+		return "format ok", nil
+	}
+}
+
+var githubPATPattern = regexp.MustCompile(`^github_pat_[0-9A-Za-z]{22}_[0-9A-Za-z]{59}$`)
+
+func validateGitHubKey(key string) (string, error) {
+	if strings.HasPrefix(key, "github_pat_") {
+		if !githubPATPattern.MatchString(key) {
+			return "", fmt.Errorf("does not match the fine-grained token format")
+		}
+		return "format ok (fine-grained token, no checksum)", nil
+	}
+	for _, prefix := range []string{"ghp_", "gho_", "ghu_", "ghs_", "ghr_"} {
+		if strings.HasPrefix(key, prefix) {
+			return validateCRC32Token(prefix)(key)
+		}
+	}
+	return "", fmt.Errorf("unknown github token prefix")
+}
+
+func validateCRC32Token(prefix string) keyValidator {
+	return func(key string) (string, error) {
+		body := strings.TrimPrefix(key, prefix)
+		if body == key || len(body) != 36 {
+			return "", fmt.Errorf("expected %s followed by 36 characters", prefix)
+		}
+		for _, c := range body {
+			if !strings.ContainsRune(base62Alphabet, c) {
+				return "", fmt.Errorf("contains non-alphanumeric characters")
+			}
+		}
+		if body[30:] != encodeBase62(crc32.ChecksumIEEE([]byte(body[:30])), 6) {
+			return "", fmt.Errorf("checksum mismatch")
+		}
+		return "checksum ok", nil
+	}
+}
+
+func encodeBase62(n uint32, width int) string {
+	var out []byte
+	for n > 0 {
+		out = append([]byte{base62Alphabet[n%62]}, out...)
+		n /= 62
+	}
+	for len(out) < width {
+		out = append([]byte{'0'}, out...)
+	}
+	return string(out)
+}
+
+var awsKeyPattern = regexp.MustCompile(`^(AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|APKA|AROA|ASCA)[A-Z2-7]{16}$`)
+
+func validateAWSKey(key string) (string, error) {
+	if !awsKeyPattern.MatchString(key) {
+		return "", fmt.Errorf("does not match the aws access key format")
+	}
+	decoded, err := base32.StdEncoding.DecodeString(key[4:])
+	if err != nil {
+		return "format ok", nil
+	}
+	var buf [8]byte
+	copy(buf[2:], decoded[:6])
+	account := (binary.BigEndian.Uint64(buf[:]) & 0x7fffffffff80) >> 7
+	return fmt.Sprintf("format ok, account: %012d", account), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var clockOffsets sync.Map
+
+func requestTime(ctx context.Context, serviceConfig ServiceConfig, u *url.URL) time.Time {
+	now := time.Now()
+	if serviceConfig.ClockSync {
+		now = now.Add(clockOffset(ctx, u))
+	}
+	return now
+}
+
+func clockOffset(ctx context.Context, u *url.URL) time.Duration {
+	origin := u.Scheme + "://" + u.Host
+	if offset, ok := clockOffsets.Load(origin); ok {
+		return offset.(time.Duration)
+	}
+
+	var offset time.Duration
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, origin+"/", nil)
+	if err == nil && takeRequest() {
+		var resp *http.Response
+		if resp, err = sharedHTTPClient().Do(req); err == nil {
+			resp.Body.Close()
+			var date time.Time
+			if date, err = http.ParseTime(resp.Header.Get("Date")); err == nil {
+				offset = time.Until(date)
+			}
+		}
+	}
+	if err != nil {
+		log.Warn("Clock sync failed, using local time", "host", u.Host, "error", err)
+	}
+	clockOffsets.Store(origin, offset)
+	return offset
+}
+
+func formatTimestamp(t time.Time, format string) string {
+	switch format {
+	case "rfc3339":
+		return t.UTC().Format(time.RFC3339)
+	case "unix_ms":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const commandTimeout = 30 * time.Second
+
+func verifyCommand(ctx context.Context, serviceConfig ServiceConfig, key, secret string, result VerificationResult) VerificationResult {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, serviceConfig.VerifierCommand)
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"ROQ_SERVICE=" + result.Service,
+		"ROQ_KEY=" + key,
+		"ROQ_SECRET=" + secret,
+	}
+	cmd.Stdin = strings.NewReader(key + "\n")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	runErr := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.Valid = false
+		result.Errored = true
+		result.Message = "verifier command timed out after " + commandTimeout.String()
+		return result
+	}
+
+	var output VerificationResult
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		result.Valid = false
+		result.Errored = true
+		if runErr != nil {
+			result.Message = "verifier command failed: " + runErr.Error()
+		} else {
+			result.Message = "verifier command returned invalid json"
+		}
+		return result
+	}
+
+	result.Valid = output.Valid
+	result.Message = output.Message
+	result.Details = output.Details
+	result.Scopes = output.Scopes
+	result.Errored = output.Errored
+	if result.Message == "" {
+		result.Message = "invalid key"
+		if result.Valid {
+			result.Message = "valid"
+		}
+	}
+	return result
+}
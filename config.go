@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v3"
+)
+
+const configCacheTTL = time.Hour
+
+func loadCustomConfig(source string) error {
+	var data []byte
+	var err error
+	if isRemoteConfig(source) {
+		data, err = fetchRemoteConfig(source)
+		if err != nil && opts.svcStrict {
+			return err
+		}
+		if err != nil {
+			log.Warn("Using embedded services, remote config unavailable", "url", source, "error", err)
+			return nil
+		}
+	} else {
+		data, err = os.ReadFile(source)
+		if err != nil {
+			return err
+		}
+	}
+
+	custom, problems, err := parseServicesConfig(data)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		log.Warn("Skipping broken service", "config", source, "error", problem)
+	}
+	custom = dropRemoteCommands(custom, source)
+	for name, service := range custom.Services {
+		servicesConfig.Services[strings.ToLower(name)] = service
+	}
+	return nil
+}
+
+func dropRemoteCommands(config ServicesConfig, source string) ServicesConfig {
+	if !isRemoteConfig(source) {
+		return config
+	}
+	for name, service := range config.Services {
+		dropped := service.VerifierCommand != ""
+		service.VerifierCommand = ""
+		for env, override := range service.Environments {
+			if override.VerifierCommand != "" {
+				dropped = true
+				override.VerifierCommand = ""
+				service.Environments[env] = override
+			}
+		}
+		if !dropped {
+			continue
+		}
+		log.Warn("Ignoring verifier_command from remote config, only local -config files may run commands", "service", name, "url", source)
+		if service.Method == "" {
+			delete(config.Services, name)
+			continue
+		}
+		config.Services[name] = service
+	}
+	return config
+}
+
+func resolveService(name string) string {
+	name = strings.ToLower(name)
+	if _, exists := servicesConfig.Services[name]; exists {
+		return name
+	}
+	for canonical, service := range servicesConfig.Services {
+		for _, alias := range service.Aliases {
+			if strings.EqualFold(alias, name) {
+				return canonical
+			}
+		}
+	}
+	return name
+}
+
+func applyEnvironment(serviceConfig ServiceConfig, env string) ServiceConfig {
+	override, ok := serviceConfig.Environments[env]
+	if env == "" || !ok {
+		return serviceConfig
+	}
+
+	base := reflect.ValueOf(&serviceConfig).Elem()
+	values := reflect.ValueOf(override)
+	for i := 0; i < values.NumField(); i++ {
+		value := values.Field(i)
+		if value.IsZero() {
+			continue
+		}
+		field := base.Field(i)
+		if value.Kind() == reflect.Map && !field.IsNil() {
+			merged := reflect.MakeMap(field.Type())
+			for _, k := range field.MapKeys() {
+				merged.SetMapIndex(k, field.MapIndex(k))
+			}
+			for _, k := range value.MapKeys() {
+				merged.SetMapIndex(k, value.MapIndex(k))
+			}
+			value = merged
+		}
+		field.Set(value)
+	}
+	serviceConfig.Environments = nil
+	return serviceConfig
+}
+
+func parseServicesConfig(data []byte) (ServicesConfig, []error, error) {
+	config, problems, err := decodeServices(data)
+	if err != nil {
+		return config, nil, fmt.Errorf("invalid services config: %w", err)
+	}
+	schemaProblems, err := validateServicesSchema(data)
+	if err != nil {
+		return config, nil, fmt.Errorf("invalid services config: %w", err)
+	}
+
+	names := serviceNames(data)
+	var global []string
+	for _, problem := range schemaProblems {
+		name := problemService(problem, names)
+		if name == "" {
+			global = append(global, problem)
+			continue
+		}
+		if _, ok := config.Services[name]; ok {
+			delete(config.Services, name)
+			problems = append(problems, errors.New(problem))
+		}
+	}
+	if len(global) > 0 {
+		return config, nil, schemaError(global)
+	}
+	if len(config.Services) == 0 {
+		return config, problems, fmt.Errorf("invalid services config: no valid services defined")
+	}
+	return config, problems, nil
+}
+
+func serviceNames(data []byte) []string {
+	var root struct {
+		Services map[string]yaml.Node `yaml:"services"`
+	}
+	yaml.Unmarshal(data, &root)
+	names := make([]string, 0, len(root.Services))
+	for name := range root.Services {
+		names = append(names, name)
+	}
+	return names
+}
+
+func problemService(problem string, names []string) string {
+	_, path, _ := strings.Cut(problem, ": ")
+	path, ok := strings.CutPrefix(path, "services.")
+	if !ok {
+		return ""
+	}
+	for _, name := range names {
+		if rest, found := strings.CutPrefix(path, name); found && (rest == "" || strings.ContainsAny(rest[:1], ".: ")) {
+			return name
+		}
+	}
+	return ""
+}
+
+func decodeServices(data []byte) (ServicesConfig, []error, error) {
+	config := ServicesConfig{Services: make(map[string]ServiceConfig)}
+	var root struct {
+		Services yaml.Node `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return config, nil, err
+	}
+	if root.Services.Kind != yaml.MappingNode {
+		return config, nil, fmt.Errorf("services is not a mapping")
+	}
+
+	var problems []error
+	entries := root.Services.Content
+	for i := 0; i+1 < len(entries); i += 2 {
+		name, node := entries[i].Value, entries[i+1]
+		var service ServiceConfig
+		err := node.Decode(&service)
+		var terr *yaml.TypeError
+		switch {
+		case errors.As(err, &terr):
+			err = errors.New(strings.Join(terr.Errors, "; "))
+		case err != nil:
+		case service.Name == "":
+			err = fmt.Errorf("missing name")
+		case service.Method == "" && service.VerifierCommand == "":
+			err = fmt.Errorf("missing method")
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s (line %d): %w", name, node.Line, err))
+			continue
+		}
+		config.Services[name] = service
+	}
+	return config, problems, nil
+}
+
+func readConfigSource(source string) ([]byte, error) {
+	if source == "" {
+		return servicesYAML.ReadFile("services.yaml")
+	}
+	if isRemoteConfig(source) {
+		data, err := downloadConfig(source)
+		if err == nil {
+			err = checkConfigPin(data)
+		}
+		return data, err
+	}
+	return os.ReadFile(source)
+}
+
+func validateConfig(source string) bool {
+	name := source
+	if name == "" {
+		name = "embedded services.yaml"
+	}
+	data, err := readConfigSource(source)
+	if err != nil {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to read config: "+err.Error()))
+		return false
+	}
+
+	var config ServicesConfig
+	problems, err := validateServicesSchema(data)
+	if err == nil && len(problems) == 0 {
+		err = yaml.Unmarshal(data, &config)
+	}
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), name)
+		fmt.Printf("  %s\n", dimStyle.Render(err.Error()))
+		fmt.Println()
+		return false
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), name)
+		for _, problem := range problems {
+			fmt.Printf("  %s\n", dimStyle.Render(problem))
+		}
+		fmt.Println()
+		return false
+	}
+	fmt.Printf("%s %s\n", successStyle.Render("✓"), name)
+	fmt.Printf("  %s\n", dimStyle.Render(fmt.Sprintf("%d services valid", len(config.Services))))
+	fmt.Println()
+	return true
+}
+
+func fetchRemoteConfig(url string) ([]byte, error) {
+	cachePath := configCachePath(url)
+	cached, cacheErr := os.ReadFile(cachePath)
+	if cacheErr == nil {
+		cacheErr = checkConfigPin(cached)
+	}
+	if cacheErr == nil {
+		if info, err := os.Stat(cachePath); err == nil && time.Since(info.ModTime()) < configCacheTTL {
+			return cached, nil
+		}
+	}
+
+	data, err := downloadConfig(url)
+	if err == nil {
+		err = checkConfigPin(data)
+	}
+	if err == nil {
+		_, _, err = parseServicesConfig(data)
+	}
+	if err != nil {
+		if cacheErr == nil {
+			log.Warn("Using cached remote config", "url", url, "error", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	if cachePath != "" {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err == nil {
+			os.WriteFile(cachePath, data, 0600)
+		}
+	}
+	return data, nil
+}
+
+func isRemoteConfig(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+func checkConfigPin(data []byte) error {
+	if opts.configSHA256 == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, strings.TrimSpace(opts.configSHA256)) {
+		return fmt.Errorf("checksum mismatch, got sha256 %s", got)
+	}
+	return nil
+}
+
+func downloadConfig(source string) ([]byte, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPlaintext(u); err != nil {
+		return nil, errors.New("refusing to fetch a services config over plaintext http, use -insecure-allow-plaintext to allow it")
+	}
+	resp, err := newHTTPClient().Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http %d", resp.StatusCode)
+	}
+	return readBody(resp.Body)
+}
+
+func configCachePath(url string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, "roq", "config-"+hex.EncodeToString(sum[:8])+".yaml")
+}
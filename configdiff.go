@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type ServiceDiff struct {
+	Service string        `json:"service"`
+	Fields  []FieldChange `json:"fields"`
+}
+
+type ConfigDiff struct {
+	Source    string        `json:"source"`
+	Added     []string      `json:"added,omitempty"`
+	Changed   []ServiceDiff `json:"changed,omitempty"`
+	Removed   []string      `json:"removed,omitempty"`
+	Unchanged int           `json:"unchanged"`
+}
+
+func diffConfig(source string) bool {
+	data, err := readConfigSource(source)
+	if err != nil {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to read config: "+err.Error()))
+		return false
+	}
+	custom, problems, err := parseServicesConfig(data)
+	if err != nil {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to load config: "+err.Error()))
+		return false
+	}
+	for _, problem := range problems {
+		log.Warn("Skipping broken service", "config", source, "error", problem)
+	}
+	custom = dropRemoteCommands(custom, source)
+
+	diff := diffServices(servicesConfig.Services, custom.Services)
+	diff.Source = source
+	if opts.jsonOutput {
+		writeJSON(diff)
+	} else {
+		displayConfigDiff(diff)
+	}
+	return true
+}
+
+func diffServices(embedded, custom map[string]ServiceConfig) ConfigDiff {
+	var diff ConfigDiff
+	seen := make(map[string]bool)
+	for name, after := range custom {
+		name = strings.ToLower(name)
+		seen[name] = true
+		before, ok := embedded[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+		if fields := diffFields(before, after); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, ServiceDiff{Service: name, Fields: fields})
+		} else {
+			diff.Unchanged++
+		}
+	}
+	for name := range embedded {
+		if !seen[name] {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Service < diff.Changed[j].Service })
+	return diff
+}
+
+func diffFields(before, after ServiceConfig) []FieldChange {
+	var changes []FieldChange
+	old, updated := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := 0; i < old.NumField(); i++ {
+		if reflect.DeepEqual(old.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+		name, _, _ := strings.Cut(old.Type().Field(i).Tag.Get("yaml"), ",")
+		changes = append(changes, FieldChange{Field: name, Before: describeField(old.Field(i)), After: describeField(updated.Field(i))})
+	}
+	return changes
+}
+
+func describeField(value reflect.Value) string {
+	if value.IsZero() {
+		return "(unset)"
+	}
+	if stringer, ok := value.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	switch value.Kind() {
+	case reflect.Slice:
+		if strs, ok := value.Interface().([]string); ok {
+			return "[" + strings.Join(strs, ", ") + "]"
+		}
+		return fmt.Sprintf("%d entries", value.Len())
+	case reflect.Map:
+		if pairs, ok := value.Interface().(map[string]string); ok {
+			var items []string
+			for _, k := range sortedKeys(pairs) {
+				items = append(items, k+": "+pairs[k])
+			}
+			return "{" + strings.Join(items, ", ") + "}"
+		}
+		return fmt.Sprintf("%d entries", value.Len())
+	}
+	return fmt.Sprintf("%v", value.Interface())
+}
+
+func displayConfigDiff(diff ConfigDiff) {
+	fmt.Println()
+	fmt.Printf("%s %s\n", highlightStyle.Render("config diff:"), dimStyle.Render(fmt.Sprintf("embedded → %s: %d added, %d changed, %d only embedded, %d unchanged", diff.Source, len(diff.Added), len(diff.Changed), len(diff.Removed), diff.Unchanged)))
+	for _, name := range diff.Added {
+		fmt.Printf("  %s %s\n", successStyle.Render("+"), name)
+	}
+	for _, service := range diff.Changed {
+		fmt.Printf("  %s %s\n", warnStyle.Render("~"), service.Service)
+		for _, field := range service.Fields {
+			fmt.Printf("      %s %s %s %s\n", dimStyle.Render(field.Field+":"), errorStyle.Render(field.Before), dimStyle.Render("→"), successStyle.Render(field.After))
+		}
+	}
+	if len(diff.Removed) > 0 {
+		fmt.Printf("  %s %s\n", errorStyle.Render("-"), dimStyle.Render("not in "+diff.Source+", still loaded from the embedded set: "+headList(10, strings.Join(diff.Removed, ", "))))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var csvColumns = []string{"service", "key", "secret"}
+
+func loadCSVJobs(r io.Reader) ([]batchJob, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	columns := map[string]int{"service": 0, "key": 1, "secret": 2}
+	var jobs []batchJob
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if first && isCSVHeader(record) {
+			columns = make(map[string]int)
+			for i, name := range record {
+				columns[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			if _, ok := columns["key"]; !ok {
+				return nil, fmt.Errorf("line %d: csv header has no key column", line)
+			}
+			continue
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		job := batchJob{service: field("service"), key: field("key"), secret: field("secret")}
+		if job.service == "" {
+			job.service = opts.service
+		}
+		if job.secret == "" {
+			job.secret = opts.secret
+		}
+		switch {
+		case job.service == "":
+			job.service = "input"
+			job.skip = fmt.Sprintf("line %d: missing service", line)
+		case job.key == "":
+			job.skip = fmt.Sprintf("line %d: missing key", line)
+		case !serviceAllowed(job.service):
+			continue
+		}
+		jobs = append(jobs, job)
+		if opts.count > 0 && len(jobs) >= opts.count {
+			break
+		}
+	}
+	return jobs, nil
+}
+
+func isCSVHeader(record []string) bool {
+	for _, cell := range record {
+		cell = strings.ToLower(strings.TrimSpace(cell))
+		for _, column := range csvColumns {
+			if cell == column {
+				return true
+			}
+		}
+	}
+	return false
+}
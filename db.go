@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	_ "modernc.org/sqlite"
+)
+
+const historySchema = `CREATE TABLE IF NOT EXISTS results (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	service    TEXT NOT NULL,
+	key_hash   TEXT NOT NULL,
+	key_masked TEXT NOT NULL,
+	valid      INTEGER NOT NULL,
+	errored    INTEGER NOT NULL,
+	message    TEXT NOT NULL,
+	details    TEXT NOT NULL,
+	checked_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_service ON results (service, checked_at);`
+
+type HistoryEntry struct {
+	Service   string `json:"service"`
+	KeyHash   string `json:"key_hash"`
+	Key       string `json:"key"`
+	Valid     bool   `json:"valid"`
+	Errored   bool   `json:"errored,omitempty"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	CheckedAt string `json:"checked_at"`
+}
+
+var historyDB *sql.DB
+
+func openHistory(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return err
+	}
+	historyDB = db
+	return nil
+}
+
+func closeHistory() {
+	if historyDB != nil {
+		historyDB.Close()
+		historyDB = nil
+	}
+}
+
+func keyHash(service, key string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(service) + ":" + key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func recordResult(result VerificationResult, key string) {
+	if historyDB == nil || result.Skipped {
+		return
+	}
+	checkedAt := result.Timestamp
+	if checkedAt == "" {
+		checkedAt = time.Now().Format(time.RFC3339)
+	}
+	_, err := historyDB.Exec(
+		"INSERT INTO results (service, key_hash, key_masked, valid, errored, message, details, checked_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		result.Service, keyHash(result.Service, normalizeKey(key, false)), result.Key, result.Valid, result.Errored, result.Message, result.Details, checkedAt,
+	)
+	if err != nil {
+		log.Warn("Failed to record result", "error", err)
+	}
+}
+
+func queryHistory(service string) ([]HistoryEntry, error) {
+	query := "SELECT service, key_hash, key_masked, valid, errored, message, details, checked_at FROM results"
+	var args []interface{}
+	if service != "" && service != "all" {
+		query += " WHERE service = ?"
+		args = append(args, strings.ToLower(service))
+	}
+	query += " ORDER BY checked_at, id"
+
+	rows, err := historyDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		if err := rows.Scan(&entry.Service, &entry.KeyHash, &entry.Key, &entry.Valid, &entry.Errored, &entry.Message, &entry.Details, &entry.CheckedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func displayHistory(entries []HistoryEntry) {
+	fmt.Println()
+	if len(entries) == 0 {
+		fmt.Println(dimStyle.Render("no recorded results"))
+		fmt.Println()
+		return
+	}
+	for _, entry := range entries {
+		mark := errorStyle.Render("✗")
+		info := entry.Message
+		if entry.Valid {
+			mark = successStyle.Render("✓")
+			if entry.Details != "" {
+				info = entry.Details
+			}
+		}
+		fmt.Printf("%s %s %s %s %s\n", dimStyle.Render(entry.CheckedAt), mark, entry.Service, dimStyle.Render(entry.Key+" ["+entry.KeyHash+"]"), dimStyle.Render(strings.ToLower(info)))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const debugBodyLimit = 4096
+
+type requestTrace struct {
+	Method          string            `yaml:"method"`
+	URL             string            `yaml:"url"`
+	RequestHeaders  map[string]string `yaml:"request_headers,omitempty"`
+	Status          int               `yaml:"status,omitempty"`
+	ResponseHeaders map[string]string `yaml:"response_headers,omitempty"`
+	Body            string            `yaml:"body,omitempty"`
+	Error           string            `yaml:"error,omitempty"`
+}
+
+type RequestInfo struct {
+	Method  string   `json:"method"`
+	URL     string   `json:"url"`
+	Headers []string `json:"headers,omitempty"`
+}
+
+type debugExport struct {
+	Service  string         `yaml:"service"`
+	Result   debugResult    `yaml:"result"`
+	Requests []requestTrace `yaml:"requests,omitempty"`
+	Config   ServiceConfig  `yaml:"config"`
+}
+
+type debugResult struct {
+	Valid   bool   `yaml:"valid"`
+	Message string `yaml:"message"`
+	Details string `yaml:"details,omitempty"`
+}
+
+func newRequestTrace(step ServiceConfig, data map[string]string, resp *http.Response, body []byte, err error) requestTrace {
+	trace := requestTrace{Method: step.Method, URL: requestURL(step, data)}
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	if resp == nil {
+		return trace
+	}
+
+	trace.Method = resp.Request.Method
+	trace.URL = resp.Request.URL.String()
+	trace.RequestHeaders = flattenHeaders(resp.Request.Header, true)
+	trace.Status = resp.StatusCode
+	trace.ResponseHeaders = flattenHeaders(resp.Header, false)
+	trace.Body = string(body)
+	if len(trace.Body) > debugBodyLimit {
+		trace.Body = trace.Body[:debugBodyLimit] + "... (truncated)"
+	}
+	return trace
+}
+
+func describeRequest(step ServiceConfig, data map[string]string, resp *http.Response, key, secret string) *RequestInfo {
+	info := &RequestInfo{Method: step.Method, URL: requestURL(step, data)}
+	headers := make([]string, 0, len(step.Headers))
+	for name := range step.Headers {
+		headers = append(headers, http.CanonicalHeaderKey(name))
+	}
+	if resp != nil {
+		info.Method = resp.Request.Method
+		info.URL = resp.Request.URL.String()
+		headers = headers[:0]
+		for name := range resp.Request.Header {
+			headers = append(headers, name)
+		}
+	}
+	sort.Strings(headers)
+	info.Headers = headers
+	info.URL = redact(info.URL, key, url.QueryEscape(key), secret, url.QueryEscape(secret))
+	return info
+}
+
+func flattenHeaders(header http.Header, request bool) map[string]string {
+	flattened := make(map[string]string, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		if request && isSensitiveHeader(name) {
+			value = maskKey(value)
+		}
+		flattened[name] = value
+	}
+	return flattened
+}
+
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	if name == "authorization" || name == "cookie" || name == "proxy-authorization" {
+		return true
+	}
+	for _, marker := range []string{"key", "token", "secret", "auth", "signature"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeDebugExport(path, service string, result VerificationResult, key, secret string) error {
+	export := debugExport{
+		Service:  strings.ToLower(service),
+		Result:   debugResult{Valid: result.Valid, Message: result.Message, Details: result.Details},
+		Requests: result.trace,
+		Config:   servicesConfig.Services[resolveService(service)],
+	}
+
+	data, err := yaml.Marshal(export)
+	if err != nil {
+		return err
+	}
+
+	values := redactionSet(normalizeKey(key, true), normalizeKey(secret, false))
+	return os.WriteFile(path, []byte(redact(string(data), values...)), 0600)
+}
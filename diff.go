@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type ResultChange struct {
+	Service string `json:"service"`
+	Key     string `json:"key"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Message string `json:"message"`
+}
+
+type RunDiff struct {
+	Baseline  string               `json:"baseline"`
+	Changed   []ResultChange       `json:"changed,omitempty"`
+	Added     []VerificationResult `json:"added,omitempty"`
+	Removed   []VerificationResult `json:"removed,omitempty"`
+	Unchanged int                  `json:"unchanged"`
+}
+
+var baselineResults []VerificationResult
+
+func loadBaseline(path string) ([]VerificationResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []VerificationResult
+	if err := json.Unmarshal(data, &results); err == nil {
+		return results, nil
+	}
+	var batch BatchResult
+	if err := json.Unmarshal(data, &batch); err == nil && batch.Results != nil {
+		return batch.Results, nil
+	}
+	var single VerificationResult
+	if err := json.Unmarshal(data, &single); err != nil || single.Service == "" {
+		return nil, fmt.Errorf("%s is not a roq json result file", path)
+	}
+	return []VerificationResult{single}, nil
+}
+
+func writeResultsFile(path string, results []VerificationResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+func resultState(result VerificationResult) string {
+	switch {
+	case result.Valid:
+		return "valid"
+	case result.Errored:
+		return "errored"
+	}
+	return "invalid"
+}
+
+func resultID(result VerificationResult) string {
+	if result.ID != "" {
+		return strings.ToLower(result.Service) + ":" + result.ID
+	}
+	return maskedResultID(result)
+}
+
+func maskedResultID(result VerificationResult) string {
+	return strings.ToLower(result.Service) + ":" + result.Key
+}
+
+func diffResults(baseline, current []VerificationResult) RunDiff {
+	diff := RunDiff{Baseline: opts.diff}
+	before := make(map[string]VerificationResult)
+	for _, result := range baseline {
+		if !result.Skipped {
+			before[resultID(result)] = result
+		}
+	}
+
+	seen := make(map[string]bool)
+	matched := make(map[string]bool)
+	for _, result := range current {
+		id := resultID(result)
+		if result.Skipped || seen[id] {
+			continue
+		}
+		seen[id] = true
+		old, ok := before[id]
+		if !ok {
+			id = maskedResultID(result)
+			old, ok = before[id]
+			ok = ok && old.ID == ""
+		}
+		if ok {
+			matched[id] = true
+		}
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, result)
+		case resultState(old) != resultState(result):
+			diff.Changed = append(diff.Changed, ResultChange{
+				Service: result.Service,
+				Key:     result.Key,
+				Before:  resultState(old),
+				After:   resultState(result),
+				Message: result.Message,
+			})
+		default:
+			diff.Unchanged++
+		}
+	}
+	for id, result := range before {
+		if !matched[id] {
+			diff.Removed = append(diff.Removed, result)
+		}
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool { return resultID(diff.Removed[i]) < resultID(diff.Removed[j]) })
+	return diff
+}
+
+func displayDiff(diff RunDiff) {
+	fmt.Printf("%s %s\n", highlightStyle.Render("diff:"), dimStyle.Render(fmt.Sprintf("against %s: %d changed, %d added, %d removed, %d unchanged", diff.Baseline, len(diff.Changed), len(diff.Added), len(diff.Removed), diff.Unchanged)))
+	for _, change := range diff.Changed {
+		mark := errorStyle.Render("~")
+		if change.After == "valid" {
+			mark = successStyle.Render("~")
+		}
+		fmt.Printf("  %s %s %s %s\n", mark, strings.ToLower(change.Service), dimStyle.Render(change.Key), highlightStyle.Render(change.Before+" → "+change.After))
+	}
+	for _, result := range diff.Added {
+		fmt.Printf("  %s %s %s %s\n", successStyle.Render("+"), strings.ToLower(result.Service), dimStyle.Render(result.Key), dimStyle.Render(resultState(result)))
+	}
+	for _, result := range diff.Removed {
+		fmt.Printf("  %s %s %s %s\n", errorStyle.Render("-"), strings.ToLower(result.Service), dimStyle.Render(result.Key), dimStyle.Render("not checked in this run"))
+	}
+	fmt.Println()
+}
+
+func reportRun(results []VerificationResult) {
+	if opts.output != "" {
+		if err := writeResultsFile(opts.output, results); err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to write results: "+err.Error()))
+		}
+	}
+	if opts.sarif != "" {
+		if err := writeSARIF(opts.sarif, results); err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to write sarif: "+err.Error()))
+		}
+	}
+	if opts.diff == "" {
+		return
+	}
+	diff := diffResults(baselineResults, results)
+	if opts.jsonOutput {
+		writeJSON(diff)
+	} else {
+		displayDiff(diff)
+	}
+}
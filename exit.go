@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+var outcomeRanks = map[string]int{"valid": 0, "invalid": 1, "unknown": 2, "errored": 3}
+
+func resultOutcome(result VerificationResult) string {
+	if !result.Valid && !result.Errored && (result.Skipped || result.ReasonCode == "manual_check") {
+		return "unknown"
+	}
+	return resultState(result)
+}
+
+func exitCode(results []VerificationResult) int {
+	worst := "valid"
+	for _, result := range results {
+		if outcome := resultOutcome(result); outcomeRanks[outcome] > outcomeRanks[worst] {
+			worst = outcome
+		}
+	}
+	switch worst {
+	case "invalid":
+		return opts.invalidExit
+	case "unknown":
+		return opts.unknownExit
+	case "errored":
+		return opts.errorExit
+	}
+	return opts.validExit
+}
+
+func exitWith(results []VerificationResult) {
+	if code := exitCode(results); code != 0 {
+		flushHAR()
+		closeTunnel()
+		os.Exit(code)
+	}
+}
+
+func checkExitCodes() error {
+	for name, code := range map[string]int{"valid-exit": opts.validExit, "invalid-exit": opts.invalidExit, "error-exit": opts.errorExit, "unknown-exit": opts.unknownExit} {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("invalid -%s: %d (use 0-255)", name, code)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var expiryLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+type thresholdValue struct {
+	d *time.Duration
+}
+
+func (v thresholdValue) String() string {
+	if v.d == nil || *v.d == 0 {
+		return ""
+	}
+	return v.d.String()
+}
+
+func (v thresholdValue) Set(s string) error {
+	d, err := parseThreshold(s)
+	if err != nil {
+		return err
+	}
+	*v.d = d
+	return nil
+}
+
+func parseThreshold(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid day count %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+func parseExpiry(value string) (time.Time, bool) {
+	for _, layout := range expiryLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil && secs > 0 {
+		return time.Unix(secs, 0), true
+	}
+	return time.Time{}, false
+}
+
+func markExpiring(result VerificationResult) VerificationResult {
+	if opts.warnExpiring <= 0 || !result.Valid || result.ExpiresAt == "" {
+		return result
+	}
+	expires, ok := parseExpiry(result.ExpiresAt)
+	if !ok {
+		return result
+	}
+	if time.Until(expires) <= opts.warnExpiring {
+		result.ExpiringSoon = true
+	}
+	return result
+}
+
+func expiryWarning(result VerificationResult) string {
+	expires, ok := parseExpiry(result.ExpiresAt)
+	if !ok {
+		return "expires soon: " + result.ExpiresAt
+	}
+	left := time.Until(expires)
+	if left <= 0 {
+		return "expired: " + result.ExpiresAt
+	}
+	if left < 24*time.Hour {
+		return fmt.Sprintf("expires in %s: %s", left.Round(time.Minute), result.ExpiresAt)
+	}
+	days := int((left + 12*time.Hour) / (24 * time.Hour))
+	if days == 1 {
+		return "expires in 1 day: " + result.ExpiresAt
+	}
+	return fmt.Sprintf("expires in %d days: %s", days, result.ExpiresAt)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+func explainService(service string) {
+	serviceConfig, exists := servicesConfig.Services[resolveService(service)]
+	if !exists {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("unsupported service: "+service))
+		os.Exit(1)
+	}
+	serviceConfig = applyEnvironment(serviceConfig, opts.env)
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", highlightStyle.Render(resolveService(service)), dimStyle.Render("("+serviceConfig.Name+")"))
+	if serviceConfig.RequiresSecret {
+		explainLine("secret", "required, pass the "+secretLabel(serviceConfig)+" with -secret")
+	}
+	if len(serviceConfig.Tags) > 0 {
+		explainLine("tags", strings.Join(serviceConfig.Tags, ", "))
+	}
+	if len(serviceConfig.ModeFromPrefix) > 0 {
+		var modes []string
+		for _, prefix := range sortedKeys(serviceConfig.ModeFromPrefix) {
+			modes = append(modes, prefix+"... "+serviceConfig.ModeFromPrefix[prefix])
+		}
+		explainLine("mode", strings.Join(modes, ", "))
+	}
+	if serviceConfig.PlaintextNote != "" {
+		explainLine("plaintext", strings.ToLower(serviceConfig.PlaintextNote)+", needs -insecure-allow-plaintext")
+	}
+	for _, prefix := range sortedKeys(serviceConfig.ManualPrefixes) {
+		explainLine("manual", prefix+"... "+strings.ToLower(serviceConfig.ManualPrefixes[prefix]))
+	}
+
+	switch {
+	case serviceConfig.VerifierCommand != "":
+		explainLine("strategy", "external command "+serviceConfig.VerifierCommand)
+		explainLine("valid if", "the command prints {\"valid\": true}")
+	case serviceConfig.Method == "SDK" && serviceConfig.SDKType == "aws":
+		explainLine("strategy", "aws sdk sts:GetCallerIdentity signed with the key and secret")
+		explainLine("valid if", "sts returns the caller account and arn")
+	case serviceConfig.Method == "SDK" && serviceConfig.SDKType == "k8s":
+		explainLine("strategy", "kubernetes TokenReview posted to the api server from -kubeconfig or -k8s-server")
+		explainLine("valid if", "status.authenticated is true")
+	case serviceConfig.Method == "HMAC_VERIFY":
+		algorithm := serviceConfig.Algorithm
+		if algorithm == "" {
+			algorithm = "sha256"
+		}
+		explainLine("strategy", "offline hmac-"+strings.ToLower(algorithm)+" of the configured payload using the key")
+		explainLine("valid if", "the result matches the configured signature")
+	case serviceConfig.Method == "IMAP" || serviceConfig.Method == "SMTP":
+		user := "the -secret"
+		if serviceConfig.AuthUser != "" {
+			user = serviceConfig.AuthUser
+		}
+		explainLine("strategy", strings.ToLower(serviceConfig.Method)+" login to "+serviceConfig.URL+" as "+user+" with the key as the password")
+		explainLine("valid if", "the server accepts the login; a refused connection is an error, not an invalid key")
+	case serviceConfig.Method == "MANUAL":
+		explainLine("strategy", "no automated check")
+		explainLine("note", strings.ToLower(serviceConfig.Message))
+	case serviceConfig.Method == "STEPS":
+		for i, step := range serviceConfig.Steps {
+			fmt.Printf("  %s\n", dimStyle.Render(fmt.Sprintf("step %d:", i+1)))
+			explainRequest(step, "    ")
+			if len(step.Extract) > 0 {
+				explainLine("    extract", strings.Join(sortedKeys(step.Extract), ", "))
+			}
+			if len(step.ExtractRegex) > 0 {
+				explainLine("    extract regex", strings.Join(sortedKeys(step.ExtractRegex), ", "))
+			}
+			if len(step.ExtractHeader) > 0 {
+				explainLine("    extract header", strings.Join(sortedKeys(step.ExtractHeader), ", "))
+			}
+			if step.Optional {
+				explainLine("    optional", "a failure here does not abort the chain")
+			}
+		}
+		explainLine("decided by", "the last step")
+	default:
+		explainRequest(serviceConfig, "")
+	}
+	for i, step := range serviceConfig.Enrich {
+		fmt.Printf("  %s\n", dimStyle.Render(fmt.Sprintf("with -enrich, request %d:", i+1)))
+		explainLine("    request", step.Method+" "+step.URL)
+		explainLine("    details", step.DetailsFormat)
+	}
+	fmt.Println()
+}
+
+func explainRequest(serviceConfig ServiceConfig, indent string) {
+	explainLine(indent+"request", serviceConfig.Method+" "+serviceConfig.URL)
+	for _, name := range sortedKeys(serviceConfig.Headers) {
+		if strings.EqualFold(name, "User-Agent") {
+			continue
+		}
+		explainLine(indent+"header", name+": "+serviceConfig.Headers[name])
+	}
+	if serviceConfig.Referer != "" {
+		explainLine(indent+"referer", serviceConfig.Referer)
+	}
+	if serviceConfig.Origin != "" {
+		explainLine(indent+"origin", serviceConfig.Origin)
+	}
+	for _, name := range sortedKeys(serviceConfig.Cookies) {
+		explainLine(indent+"cookie", name+"="+serviceConfig.Cookies[name])
+	}
+	switch serviceConfig.AuthType {
+	case "basic":
+		explainLine(indent+"auth", "basic, user "+serviceConfig.AuthUser+", pass "+serviceConfig.AuthPass)
+	case "sigv4":
+		explainLine(indent+"auth", "aws sigv4 for service "+serviceConfig.Service)
+	case "hmac":
+		explainLine(indent+"auth", "hmac of "+serviceConfig.SigningString+" in "+serviceConfig.SignatureHeader)
+	}
+	if serviceConfig.Body != "" {
+		explainLine(indent+"body", serviceConfig.Body)
+	}
+	if serviceConfig.BodyType == "multipart" {
+		for _, name := range sortedKeys(serviceConfig.Form) {
+			explainLine(indent+"form", name+"="+serviceConfig.Form[name])
+		}
+		if serviceConfig.FormFile != "" {
+			explainLine(indent+"form file", serviceConfig.FormFile)
+		}
+	}
+	if serviceConfig.ClockSync {
+		explainLine(indent+"clock", "timestamps follow the Date header of "+serviceConfig.URL)
+	}
+	if len(serviceConfig.Regions) > 0 {
+		explainLine(indent+"regions", "tried in order until one is valid: "+strings.Join(serviceConfig.Regions, ", "))
+	}
+	if names := envVars(serviceConfig); len(names) > 0 {
+		explainLine(indent+"env", strings.Join(names, ", ")+" (templates only see variables starting with ROQ_)")
+	}
+
+	explainLine(indent+"valid if", explainValidity(serviceConfig))
+	if serviceConfig.ErrorField != "" {
+		explainLine(indent+"invalid if", "error field "+serviceConfig.ErrorField+" is set")
+	}
+	if len(serviceConfig.InvalidBodyContains) > 0 {
+		explainLine(indent+"invalid if", "body contains "+strings.Join(serviceConfig.InvalidBodyContains, " or "))
+	}
+	if serviceConfig.StatusField != "" && len(serviceConfig.ActiveStatus) > 0 {
+		explainLine(indent+"inactive if", serviceConfig.StatusField+" is not "+strings.Join(serviceConfig.ActiveStatus, " or "))
+	}
+	if serviceConfig.ExpiryField != "" || serviceConfig.ExpiryHeader != "" {
+		explainLine(indent+"expiry", strings.TrimSpace(serviceConfig.ExpiryField+" "+serviceConfig.ExpiryHeader))
+	}
+	if serviceConfig.DetailsFormat != "" {
+		explainLine(indent+"details", serviceConfig.DetailsFormat)
+	}
+}
+
+func explainValidity(serviceConfig ServiceConfig) string {
+	status := "http " + serviceConfig.SuccessStatus.String()
+	switch {
+	case serviceConfig.SuccessField != "":
+		return status + " and " + serviceConfig.SuccessField + " is true"
+	case serviceConfig.ItemsPath != "":
+		return status + " and json " + serviceConfig.ItemsPath + " is a list"
+	case serviceConfig.ResponseType == "json" && len(serviceConfig.ResponseFields) > 0,
+		serviceConfig.ResponseType == "xml" && len(serviceConfig.ResponseFields) > 0:
+		return status + " and " + serviceConfig.ResponseType + " has any of " + strings.Join(serviceConfig.ResponseFields, ", ") + " (all with -strict)"
+	}
+	return status
+}
+
+func explainLine(label, value string) {
+	fmt.Printf("  %s %s\n", dimStyle.Render(fmt.Sprintf("%-16s", label+":")), value)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func displayServicesDetailed() {
+	names := make([]string, 0, len(servicesConfig.Services))
+	width := 0
+	for name, serviceConfig := range servicesConfig.Services {
+		if !serviceTagged(serviceConfig) {
+			continue
+		}
+		names = append(names, name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	fmt.Println(highlightStyle.Render("supported services:"))
+	fmt.Println()
+	for _, name := range names {
+		serviceConfig := servicesConfig.Services[name]
+		info := []string{serviceConfig.Method, describeAuth(serviceConfig)}
+		if serviceConfig.RequiresSecret {
+			info = append(info, "needs -secret ("+secretLabel(serviceConfig)+")")
+		}
+		if len(serviceConfig.KeyPrefixes) > 0 {
+			prefixes := make([]string, 0, len(serviceConfig.KeyPrefixes))
+			for prefix := range serviceConfig.KeyPrefixes {
+				prefixes = append(prefixes, prefix+"...")
+			}
+			sort.Strings(prefixes)
+			info = append(info, "keys: "+strings.Join(prefixes, " "))
+		}
+		if _, ok := keyValidators[name]; ok {
+			info = append(info, "offline check")
+		}
+		if len(serviceConfig.Aliases) > 0 {
+			info = append(info, "aliases: "+strings.Join(serviceConfig.Aliases, " "))
+		}
+		if len(serviceConfig.Tags) > 0 {
+			info = append(info, "tags: "+strings.Join(serviceConfig.Tags, " "))
+		}
+		fmt.Printf("  • %-*s %s\n", width, name, dimStyle.Render(strings.Join(info, " · ")))
+	}
+	fmt.Println()
+}
+
+func describeAuth(serviceConfig ServiceConfig) string {
+	if serviceConfig.VerifierCommand != "" {
+		return "external command"
+	}
+	switch serviceConfig.Method {
+	case "SDK":
+		return serviceConfig.SDKType + " sdk"
+	case "HMAC_VERIFY":
+		return "offline hmac"
+	case "MANUAL":
+		return "manual"
+	case "IMAP", "SMTP":
+		return strings.ToLower(serviceConfig.Method) + " login"
+	case "STEPS":
+		if len(serviceConfig.Steps) > 0 {
+			return describeAuth(serviceConfig.Steps[0])
+		}
+	}
+	if serviceConfig.AuthType != "" {
+		return serviceConfig.AuthType + " auth"
+	}
+	for _, name := range sortedKeys(serviceConfig.Headers) {
+		if usesInput(serviceConfig.Headers[name]) {
+			return "header " + name
+		}
+	}
+	for _, name := range sortedKeys(serviceConfig.Cookies) {
+		if usesInput(serviceConfig.Cookies[name]) {
+			return "cookie " + name
+		}
+	}
+	if usesInput(serviceConfig.URL) {
+		return "key in url"
+	}
+	for _, name := range sortedKeys(serviceConfig.Form) {
+		if usesInput(serviceConfig.Form[name]) {
+			return "form field " + name
+		}
+	}
+	if usesInput(serviceConfig.Body) {
+		return "key in body"
+	}
+	return "no auth"
+}
+
+var requestVars = strings.NewReplacer("{{.UserAgent}}", "", "{{.Host}}", "", "{{.Scheme}}", "", "{{.Timestamp}}", "", "{{.UnixTime}}", "", "{{.Now}}", "", "{{.UUID}}", "", "{{.Region}}", "")
+
+var envRefs = regexp.MustCompile(`{{\s*\.Env\.(\w+)\s*}}`)
+
+func usesInput(value string) bool {
+	return strings.Contains(requestVars.Replace(envRefs.ReplaceAllString(value, "")), "{{")
+}
+
+func envVars(serviceConfig ServiceConfig) []string {
+	templates := []string{serviceConfig.URL, serviceConfig.Body, serviceConfig.Referer, serviceConfig.Origin, serviceConfig.AuthUser, serviceConfig.AuthPass}
+	for _, fields := range []map[string]string{serviceConfig.Headers, serviceConfig.Cookies, serviceConfig.Form} {
+		for _, value := range fields {
+			templates = append(templates, value)
+		}
+	}
+	var names []string
+	for _, tmpl := range templates {
+		for _, match := range envRefs.FindAllStringSubmatch(tmpl, -1) {
+			if !slices.Contains(names, match[1]) {
+				names = append(names, match[1])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
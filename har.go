@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+)
+
+type harArchive struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+var (
+	harEntries []harEntry
+	harSecrets []string
+	harMu      sync.Mutex
+)
+
+type harRecorder struct {
+	next http.RoundTripper
+}
+
+type harBody struct {
+	io.ReadCloser
+	buf    bytes.Buffer
+	record func([]byte)
+	once   sync.Once
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	b.once.Do(func() { b.record(b.buf.Bytes()) })
+	return b.ReadCloser.Close()
+}
+
+func harTransport(next http.RoundTripper) http.RoundTripper {
+	if opts.har == "" {
+		return next
+	}
+	return &harRecorder{next: next}
+}
+
+func redactHAR(values ...string) {
+	harMu.Lock()
+	defer harMu.Unlock()
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || slices.Contains(harSecrets, value) {
+			continue
+		}
+		harSecrets = append(harSecrets, value)
+		if escaped := url.QueryEscape(value); escaped != value {
+			harSecrets = append(harSecrets, escaped)
+		}
+	}
+	sort.Slice(harSecrets, func(i, j int) bool { return len(harSecrets[i]) > len(harSecrets[j]) })
+}
+
+func redactCredentials(key, secret string) {
+	values := []string{key, secret}
+	if secret != "" {
+		pair := key + ":" + secret
+		values = append(values, pair, base64.StdEncoding.EncodeToString([]byte(pair)))
+	}
+	if decoded, err := decodeKey(key, "base64"); err == nil && utf8.ValidString(decoded) {
+		if _, pass, ok := strings.Cut(decoded, ":"); ok {
+			values = append(values, decoded, pass)
+		}
+	}
+	redactHAR(values...)
+}
+
+func redactionSet(extra ...string) []string {
+	harMu.Lock()
+	values := append(slices.Clone(harSecrets), extra...)
+	harMu.Unlock()
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	return values
+}
+
+func (h *harRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var payload []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			payload, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+	started := time.Now()
+	resp, err := h.next.RoundTrip(req)
+	if err != nil {
+		addHAREntry(req, payload, nil, nil, started, err)
+		return resp, err
+	}
+	resp.Body = &harBody{ReadCloser: resp.Body, record: func(body []byte) {
+		addHAREntry(req, payload, resp, body, started, nil)
+	}}
+	return resp, nil
+}
+
+func addHAREntry(req *http.Request, payload []byte, resp *http.Response, body []byte, started time.Time, reqErr error) {
+	harMu.Lock()
+	defer harMu.Unlock()
+	scrub := func(text string) string { return redact(text, harSecrets...) }
+
+	elapsed := float64(time.Since(started).Microseconds()) / 1000
+	entry := harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            elapsed,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         scrub(req.URL.String()),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header, true, scrub),
+			QueryString: harQuery(req.URL.Query(), scrub),
+			HeadersSize: -1,
+			BodySize:    len(payload),
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: harTimings{Wait: elapsed},
+	}
+	if len(payload) > 0 {
+		entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: scrub(string(payload))}
+	}
+	if reqErr != nil {
+		entry.Comment = scrub(reqErr.Error())
+	}
+	if resp != nil {
+		entry.Response.Status = resp.StatusCode
+		entry.Response.StatusText = http.StatusText(resp.StatusCode)
+		entry.Response.HTTPVersion = resp.Proto
+		entry.Response.Headers = harHeaders(resp.Header, false, scrub)
+		entry.Response.RedirectURL = resp.Header.Get("Location")
+		entry.Response.BodySize = len(body)
+		entry.Response.Content = harContent{Size: len(body), MimeType: resp.Header.Get("Content-Type"), Text: scrub(string(body))}
+	}
+
+	harEntries = append(harEntries, entry)
+}
+
+func flushHAR() {
+	harMu.Lock()
+	defer harMu.Unlock()
+	if opts.har == "" || harEntries == nil {
+		return
+	}
+	if err := writeHAR(opts.har, harEntries); err != nil {
+		log.Warn("Failed to write har", "error", err)
+	}
+	harEntries = nil
+}
+
+func harHeaders(header http.Header, request bool, scrub func(string) string) []harNameValue {
+	headers := []harNameValue{}
+	for name, value := range flattenHeaders(header, request) {
+		headers = append(headers, harNameValue{Name: name, Value: scrub(value)})
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+func harQuery(query url.Values, scrub func(string) string) []harNameValue {
+	params := []harNameValue{}
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, harNameValue{Name: name, Value: scrub(value)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+func writeHAR(path string, entries []harEntry) error {
+	archive := harArchive{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "roq", Version: version},
+		Entries: entries,
+	}}
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type kubeConfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+type k8sCluster struct {
+	server      string
+	caData      []byte
+	insecure    bool
+	token       string
+	certificate *tls.Certificate
+}
+
+type tokenReview struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Token string `json:"token"`
+	} `json:"spec"`
+	Status struct {
+		Authenticated bool   `json:"authenticated"`
+		Error         string `json:"error"`
+		User          struct {
+			Username string   `json:"username"`
+			Groups   []string `json:"groups"`
+		} `json:"user"`
+	} `json:"status"`
+}
+
+func verifyK8s(ctx context.Context, token string, result VerificationResult) VerificationResult {
+	cluster, err := loadK8sCluster()
+	if err != nil {
+		result.Valid = false
+		result.Errored = true
+		result.Message = err.Error()
+		return result
+	}
+
+	review := tokenReview{APIVersion: "authentication.k8s.io/v1", Kind: "TokenReview"}
+	review.Spec.Token = token
+	payload, _ := json.Marshal(review)
+
+	url := strings.TrimSuffix(cluster.server, "/") + "/apis/authentication.k8s.io/v1/tokenreviews"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		result.Valid = false
+		result.Errored = true
+		result.Message = "failed to create request"
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	reviewer := cluster.token
+	if reviewer == "" && cluster.certificate == nil {
+		reviewer = token
+	}
+	if reviewer != "" {
+		req.Header.Set("Authorization", "Bearer "+reviewer)
+	}
+
+	client := newHTTPClient()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cluster.insecure, MinVersion: minTLSVersion()}
+	if len(cluster.caData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cluster.caData) {
+			result.Valid = false
+			result.Errored = true
+			result.Message = "invalid cluster ca certificate"
+			return result
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	if cluster.certificate != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cluster.certificate}
+	}
+
+	client.Transport = harTransport(transport)
+
+	result.Endpoint = req.URL.Host
+	if !takeRequest() {
+		return budgetSkipped(result)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Valid = false
+		result.Errored = true
+		result.Message = "request failed: " + err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		result.Valid = false
+		result.Errored = true
+		result.Message = fmt.Sprintf("tokenreview failed (http %d)", resp.StatusCode)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			result.Details = "reviewer needs permission to create tokenreviews (use -kubeconfig)"
+		}
+		return result
+	}
+
+	body, err := readBody(resp.Body)
+	if err != nil {
+		result.Valid = false
+		result.Errored = true
+		result.Message = "failed to read response: " + err.Error()
+		return result
+	}
+	if err := json.Unmarshal(body, &review); err != nil {
+		result.Valid = false
+		result.Errored = true
+		result.Message = "invalid response format"
+		return result
+	}
+
+	if !review.Status.Authenticated {
+		result.Valid = false
+		result.Message = "invalid token"
+		if review.Status.Error != "" {
+			result.Message = strings.ToLower(review.Status.Error)
+		}
+		return result
+	}
+
+	result.Valid = true
+	result.Message = "valid"
+	result.Details = "user: " + review.Status.User.Username
+	if len(review.Status.User.Groups) > 0 {
+		result.Details += ", groups: " + strings.Join(review.Status.User.Groups, ", ")
+	}
+	return result
+}
+
+func loadK8sCluster() (k8sCluster, error) {
+	var cluster k8sCluster
+
+	path := opts.kubeconfig
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".kube", "config")
+		}
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		var kc kubeConfig
+		if err := yaml.Unmarshal(data, &kc); err != nil {
+			return cluster, fmt.Errorf("failed to parse kubeconfig: %s", err.Error())
+		}
+		if err := cluster.applyKubeConfig(kc); err != nil {
+			return cluster, err
+		}
+	} else if opts.kubeconfig != "" {
+		return cluster, fmt.Errorf("failed to read kubeconfig: %s", err.Error())
+	}
+
+	if opts.k8sServer != "" {
+		cluster.server = opts.k8sServer
+	}
+	if opts.k8sCA != "" {
+		data, err := os.ReadFile(opts.k8sCA)
+		if err != nil {
+			return cluster, fmt.Errorf("failed to read ca file: %s", err.Error())
+		}
+		cluster.caData = data
+	}
+	if cluster.server == "" {
+		return cluster, fmt.Errorf("no cluster api server (use -k8s-server or -kubeconfig)")
+	}
+	return cluster, nil
+}
+
+func (c *k8sCluster) applyKubeConfig(kc kubeConfig) error {
+	var clusterName, userName string
+	for _, kctx := range kc.Contexts {
+		if kctx.Name == kc.CurrentContext {
+			clusterName, userName = kctx.Context.Cluster, kctx.Context.User
+		}
+	}
+
+	for _, cl := range kc.Clusters {
+		if cl.Name != clusterName {
+			continue
+		}
+		c.server = cl.Cluster.Server
+		c.insecure = cl.Cluster.InsecureSkipTLSVerify
+		if cl.Cluster.CertificateAuthorityData != "" {
+			data, err := base64.StdEncoding.DecodeString(cl.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return fmt.Errorf("invalid certificate-authority-data in kubeconfig")
+			}
+			c.caData = data
+		} else if cl.Cluster.CertificateAuthority != "" {
+			data, err := os.ReadFile(cl.Cluster.CertificateAuthority)
+			if err != nil {
+				return fmt.Errorf("failed to read kubeconfig ca: %s", err.Error())
+			}
+			c.caData = data
+		}
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		c.token = u.User.Token
+		if u.User.ClientCertificateData != "" && u.User.ClientKeyData != "" {
+			certPEM, errCert := base64.StdEncoding.DecodeString(u.User.ClientCertificateData)
+			keyPEM, errKey := base64.StdEncoding.DecodeString(u.User.ClientKeyData)
+			if errCert != nil || errKey != nil {
+				return fmt.Errorf("invalid client certificate data in kubeconfig")
+			}
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return fmt.Errorf("invalid client certificate in kubeconfig: %s", err.Error())
+			}
+			c.certificate = &cert
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var mailPorts = map[string]string{"imap": "143", "imaps": "993", "smtp": "587", "smtps": "465"}
+
+var errMailRejected = errors.New("login rejected")
+
+type mailPlainAuth struct {
+	username string
+	password string
+}
+
+func (a mailPlainAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "PLAIN", []byte("\x00" + a.username + "\x00" + a.password), nil
+}
+
+func (a mailPlainAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, fmt.Errorf("unexpected server challenge")
+	}
+	return nil, nil
+}
+
+func verifyMail(ctx context.Context, serviceConfig ServiceConfig, key, secret string, result VerificationResult) VerificationResult {
+	data := templateData(key, secret)
+	username := secret
+	if serviceConfig.AuthUser != "" {
+		username = renderTemplate(serviceConfig.AuthUser, data)
+	}
+	u, err := mailURL(serviceConfig, data)
+	if err == nil && username == "" {
+		err = fmt.Errorf("no username, set auth_user or pass it with -secret")
+	}
+	if err != nil {
+		result.Valid = false
+		result.Errored = true
+		result.Message = err.Error()
+		return result
+	}
+
+	timeout := opts.timeout
+	if serviceConfig.Timeout > 0 {
+		timeout = serviceConfig.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if !takeRequest() {
+		return budgetSkipped(result)
+	}
+
+	result.Endpoint = u.Host
+	if serviceConfig.Method == "IMAP" {
+		err = imapLogin(ctx, u, username, key)
+	} else {
+		err = smtpLogin(ctx, u, username, key)
+	}
+	switch {
+	case err == nil:
+		result.Valid = true
+		result.Message = "valid"
+		result.Details = "user: " + username
+		result.explain("login_accepted", "%s server %s accepted the login for %s", strings.ToLower(serviceConfig.Method), u.Host, username)
+	case errors.Is(err, errMailRejected):
+		result.Valid = false
+		result.Message = "invalid (" + redact(err.Error(), key) + ")"
+		result.explain("login_rejected", "%s server %s rejected the login for %s", strings.ToLower(serviceConfig.Method), u.Host, username)
+	default:
+		result.Valid = false
+		result.Errored = true
+		result.Message = redact(err.Error(), key)
+		result.ReasonCode = "connection_failed"
+	}
+	return result
+}
+
+func mailURL(serviceConfig ServiceConfig, data map[string]string) (*url.URL, error) {
+	u, err := url.Parse(renderTemplate(serviceConfig.URL, data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail url: %s", err.Error())
+	}
+	if opts.instanceURL != nil {
+		u.Host = opts.instanceURL.Host
+	}
+	port, ok := mailPorts[u.Scheme]
+	if !ok || !strings.HasPrefix(u.Scheme, strings.ToLower(serviceConfig.Method)) {
+		return nil, fmt.Errorf("invalid mail url %s, use %s:// or %ss://", u.Redacted(), strings.ToLower(serviceConfig.Method), strings.ToLower(serviceConfig.Method))
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+func dialMail(ctx context.Context, u *url.URL) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if tunnel != nil {
+		conn, err = tunnelDial(ctx, "tcp", u.Host)
+	} else {
+		conn, err = dialContext(ctx, "tcp", u.Host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connection failed: %s", err.Error())
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+	if strings.HasSuffix(u.Scheme, "s") {
+		return mailTLS(ctx, conn, u)
+	}
+	return conn, nil
+}
+
+func mailTLS(ctx context.Context, conn net.Conn, u *url.URL) (net.Conn, error) {
+	serverName := opts.sni
+	if serverName == "" {
+		serverName = u.Hostname()
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, MinVersion: minTLSVersion()})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls handshake failed: %s", err.Error())
+	}
+	return tlsConn, nil
+}
+
+func allowPlainMail(u *url.URL) error {
+	return checkPlaintext(&url.URL{Scheme: "http", Host: u.Host})
+}
+
+func imapLogin(ctx context.Context, u *url.URL, username, password string) error {
+	conn, err := dialMail(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	if _, err := reader.ReadLine(); err != nil {
+		return fmt.Errorf("connection failed: %s", err.Error())
+	}
+	if u.Scheme == "imap" {
+		fmt.Fprintf(conn, "a0 STARTTLS\r\n")
+		if status, _, err := imapResponse(reader, "a0"); err != nil || status != "OK" {
+			if err := allowPlainMail(u); err != nil {
+				return fmt.Errorf("%s doesn't offer starttls: %w", u.Host, err)
+			}
+		} else {
+			if conn, err = mailTLS(ctx, conn, u); err != nil {
+				return err
+			}
+			reader = textproto.NewReader(bufio.NewReader(conn))
+		}
+	}
+
+	fmt.Fprintf(conn, "a1 LOGIN %s %s\r\n", imapQuote(username), imapQuote(password))
+	status, text, err := imapResponse(reader, "a1")
+	if err != nil {
+		return fmt.Errorf("connection failed: %s", err.Error())
+	}
+	fmt.Fprintf(conn, "a2 LOGOUT\r\n")
+	switch status {
+	case "OK":
+		return nil
+	case "NO":
+		return fmt.Errorf("%w: %s", errMailRejected, strings.ToLower(text))
+	}
+	return fmt.Errorf("imap login failed: %s", strings.ToLower(text))
+}
+
+func imapResponse(reader *textproto.Reader, tag string) (string, string, error) {
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return "", "", err
+		}
+		if rest, ok := strings.CutPrefix(line, tag+" "); ok {
+			status, text, _ := strings.Cut(rest, " ")
+			return strings.ToUpper(status), text, nil
+		}
+	}
+}
+
+func imapQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func smtpLogin(ctx context.Context, u *url.URL, username, password string) error {
+	conn, err := dialMail(ctx, u)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, u.Hostname())
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("connection failed: %s", err.Error())
+	}
+	defer client.Close()
+
+	if u.Scheme == "smtp" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			serverName := opts.sni
+			if serverName == "" {
+				serverName = u.Hostname()
+			}
+			if err := client.StartTLS(&tls.Config{ServerName: serverName, MinVersion: minTLSVersion()}); err != nil {
+				return fmt.Errorf("starttls failed: %s", err.Error())
+			}
+		} else if err := allowPlainMail(u); err != nil {
+			return fmt.Errorf("%s doesn't offer starttls: %w", u.Host, err)
+		}
+	}
+	if ok, _ := client.Extension("AUTH"); !ok {
+		return fmt.Errorf("%s doesn't offer smtp auth", u.Host)
+	}
+
+	err = client.Auth(mailPlainAuth{username: username, password: password})
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return fmt.Errorf("%w: %d %s", errMailRejected, protoErr.Code, strings.ToLower(protoErr.Msg))
+	}
+	if err != nil {
+		return fmt.Errorf("smtp auth failed: %s", err.Error())
+	}
+	client.Quit()
+	return nil
+}
@@ -3,17 +3,37 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"embed"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
@@ -21,38 +41,87 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
 	"github.com/corpix/uarand"
+	"github.com/google/uuid"
 	"github.com/rhysd/go-github-selfupdate/selfupdate"
-	"gopkg.in/yaml.v3"
 )
 
 
 const version = "1.0.1"
 
+var (
+	commit    = ""
+	buildDate = ""
+)
+
 
 //go:embed services.yaml
 var servicesYAML embed.FS
 
 type ServiceConfig struct {
-	Name           string            `yaml:"name"`
-	Method         string            `yaml:"method"`
-	URL            string            `yaml:"url"`
-	Headers        map[string]string `yaml:"headers"`
-	AuthType       string            `yaml:"auth_type"`
-	AuthUser       string            `yaml:"auth_user"`
-	AuthPass       string            `yaml:"auth_pass"`
-	SuccessStatus  int               `yaml:"success_status"`
-	ResponseType   string            `yaml:"response_type"`
-	ResponseFields []string          `yaml:"response_fields"`
-	DetailsFormat  string            `yaml:"details_format"`
-	SuccessField   string            `yaml:"success_field"`
-	ErrorField     string            `yaml:"error_field"`
-	RequiresSecret bool              `yaml:"requires_secret"`
-	SecretName     string            `yaml:"secret_name"`
-	SDKType        string            `yaml:"sdk_type"`
-	Service        string            `yaml:"service"`
-	Operation      string            `yaml:"operation"`
-	Message        string            `yaml:"message"`
-	Details        string            `yaml:"details"`
+	Name                string                   `yaml:"name,omitempty"`
+	Aliases             []string                 `yaml:"aliases,omitempty"`
+	Tags                []string                 `yaml:"tags,omitempty"`
+	Method              string                   `yaml:"method,omitempty"`
+	URL                 string                   `yaml:"url,omitempty"`
+	Headers             map[string]string        `yaml:"headers,omitempty"`
+	AuthType            string                   `yaml:"auth_type,omitempty"`
+	AuthUser            string                   `yaml:"auth_user,omitempty"`
+	AuthPass            string                   `yaml:"auth_pass,omitempty"`
+	SuccessStatus       StatusMatcher            `yaml:"success_status,omitempty"`
+	ResponseType        string                   `yaml:"response_type,omitempty"`
+	ResponseFields      []string                 `yaml:"response_fields,omitempty"`
+	ItemsPath           string                   `yaml:"items_path,omitempty"`
+	DetailsFormat       string                   `yaml:"details_format,omitempty"`
+	SuccessField        string                   `yaml:"success_field,omitempty"`
+	ErrorField          string                   `yaml:"error_field,omitempty"`
+	RequiresSecret      bool                     `yaml:"requires_secret,omitempty"`
+	SecretName          string                   `yaml:"secret_name,omitempty"`
+	SDKType             string                   `yaml:"sdk_type,omitempty"`
+	Service             string                   `yaml:"service,omitempty"`
+	Operation           string                   `yaml:"operation,omitempty"`
+	Region              string                   `yaml:"region,omitempty"`
+	Regions             []string                 `yaml:"regions,omitempty"`
+	Message             string                   `yaml:"message,omitempty"`
+	Details             string                   `yaml:"details,omitempty"`
+	Body                string                   `yaml:"body,omitempty"`
+	BodyType            string                   `yaml:"body_type,omitempty"`
+	Form                map[string]string        `yaml:"form,omitempty"`
+	FormFile            string                   `yaml:"form_file,omitempty"`
+	Extract             map[string]string        `yaml:"extract,omitempty"`
+	ExtractRegex        map[string]string        `yaml:"extract_regex,omitempty"`
+	ExtractHeader       map[string]string        `yaml:"extract_header,omitempty"`
+	Steps               []ServiceConfig          `yaml:"steps,omitempty"`
+	Payload             string                   `yaml:"payload,omitempty"`
+	Signature           string                   `yaml:"signature,omitempty"`
+	Algorithm           string                   `yaml:"algorithm,omitempty"`
+	ScopesField         string                   `yaml:"scopes_field,omitempty"`
+	ScopesHeader        string                   `yaml:"scopes_header,omitempty"`
+	KeyPrefixes         map[string]string        `yaml:"key_prefixes,omitempty"`
+	ModeFromPrefix      map[string]string        `yaml:"mode_from_prefix,omitempty"`
+	ManualPrefixes      map[string]string        `yaml:"manual_prefixes,omitempty"`
+	PlaintextNote       string                   `yaml:"plaintext_note,omitempty"`
+	Severity            string                   `yaml:"severity,omitempty"`
+	Optional            bool                     `yaml:"optional,omitempty"`
+	StripPrefix         bool                     `yaml:"strip_prefix,omitempty"`
+	KeyEncoding         string                   `yaml:"key_encoding,omitempty"`
+	VerifierCommand     string                   `yaml:"verifier_command,omitempty"`
+	SigningString       string                   `yaml:"signing_string_template,omitempty"`
+	SignatureHeader     string                   `yaml:"signature_header,omitempty"`
+	SignatureFormat     string                   `yaml:"signature_format,omitempty"`
+	StatusField         string                   `yaml:"status_field,omitempty"`
+	ActiveStatus        []string                 `yaml:"active_status,omitempty"`
+	InvalidBodyContains []string                 `yaml:"invalid_body_contains,omitempty"`
+	Cookies             map[string]string        `yaml:"cookies,omitempty"`
+	Referer             string                   `yaml:"referer,omitempty"`
+	Origin              string                   `yaml:"origin,omitempty"`
+	ExpiryField         string                   `yaml:"expiry_field,omitempty"`
+	ExpiryHeader        string                   `yaml:"expiry_header,omitempty"`
+	Enrich              []ServiceConfig          `yaml:"enrich,omitempty"`
+	TimestampFormat     string                   `yaml:"timestamp_format,omitempty"`
+	ClockSync           bool                     `yaml:"clock_sync,omitempty"`
+	Timeout             time.Duration            `yaml:"timeout,omitempty"`
+	MaxLatency          time.Duration            `yaml:"max_latency,omitempty"`
+	Environments        map[string]ServiceConfig `yaml:"environments,omitempty"`
 }
 
 type ServicesConfig struct {
@@ -60,12 +129,51 @@ type ServicesConfig struct {
 }
 
 type VerificationResult struct {
-	Service   string `json:"service"`
-	Key       string `json:"key,omitempty"`
-	Valid     bool   `json:"valid"`
-	Message   string `json:"message"`
-	Details   string `json:"details,omitempty"`
-	Timestamp string `json:"timestamp"`
+	Service      string       `json:"service"`
+	Key          string       `json:"key,omitempty"`
+	ID           string       `json:"id,omitempty"`
+	Secret       string       `json:"secret,omitempty"`
+	Valid        bool         `json:"valid"`
+	Message      string       `json:"message"`
+	Details      string       `json:"details,omitempty"`
+	Scopes       []string     `json:"scopes,omitempty"`
+	Endpoint     string       `json:"endpoint,omitempty"`
+	Errored      bool         `json:"errored,omitempty"`
+	Skipped      bool         `json:"skipped,omitempty"`
+	ExpiresAt    string       `json:"expires_at,omitempty"`
+	ExpiringSoon bool         `json:"expiring_soon,omitempty"`
+	Reason       string       `json:"reason,omitempty"`
+	ReasonCode   string       `json:"reason_code,omitempty"`
+	Mode         string       `json:"mode,omitempty"`
+	Region       string       `json:"region,omitempty"`
+	Severity     string       `json:"severity,omitempty"`
+	Request      *RequestInfo `json:"request,omitempty"`
+	Warning      string       `json:"warning,omitempty"`
+	LatencyMS    int64        `json:"latency_ms,omitempty"`
+	Timestamp    string       `json:"timestamp"`
+
+	rawResponse []byte
+	trace       []requestTrace
+}
+
+func (r *VerificationResult) explain(code, format string, args ...interface{}) {
+	r.ReasonCode = code
+	if opts.explain {
+		r.Reason = fmt.Sprintf(format, args...)
+	}
+}
+
+func (r *VerificationResult) warn(format string, args ...interface{}) {
+	if r.Warning != "" {
+		r.Warning += ", "
+	}
+	r.Warning += fmt.Sprintf(format, args...)
+}
+
+var hmacAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
 }
 
 var (
@@ -74,8 +182,16 @@ var (
 	errorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true)
 	dimStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
 	highlightStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("14"))
+	warnStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
 )
 
+func modeStyle(mode string) lipgloss.Style {
+	if strings.EqualFold(mode, "live") {
+		return warnStyle.Bold(true)
+	}
+	return dimStyle
+}
+
 func init() {
 	log.SetTimeFormat("15:04:05")
 	log.SetLevel(log.WarnLevel)
@@ -89,69 +205,508 @@ func loadServicesConfig() {
 		log.Fatal("Failed to read services.yaml", "error", err)
 	}
 
-	if err := yaml.Unmarshal(data, &servicesConfig); err != nil {
+	config, problems, err := decodeServices(data)
+	if err != nil {
 		log.Fatal("Failed to parse services.yaml", "error", err)
 	}
+	for _, problem := range problems {
+		log.Warn("Skipping broken service", "error", problem)
+	}
+	if len(config.Services) == 0 {
+		log.Fatal("Failed to load services.yaml", "error", "no valid services")
+	}
+	servicesConfig = config
+}
+
+type options struct {
+	service      string
+	key          string
+	keys         stringList
+	secret       string
+	secrets      stringList
+	file         string
+	all          bool
+	concurrency  int
+	failFast     bool
+	keepGoing    bool
+	includeReq   bool
+	count        int
+	summaryOnly  bool
+	only         map[string]bool
+	skip         map[string]bool
+	onlyList     string
+	skipList     string
+	excludeList  string
+	tagList      string
+	jsonOutput   bool
+	envelope     bool
+	listServices bool
+	showHelp     bool
+	showVersion  bool
+	doUpdate     bool
+	stsEndpoint  string
+	resolver     string
+	preferIPv6   bool
+	rawResponse  bool
+	maxBody      int64
+	debug        bool
+	rawMax       int
+	debugExport  string
+	har          string
+	watch        time.Duration
+	watchVerbose bool
+	webhook      string
+	kubeconfig   string
+	k8sServer    string
+	k8sCA        string
+	timeout      time.Duration
+	timeoutTotal time.Duration
+	format       string
+	sessionToken string
+	sshTunnel    string
+	userAgent    string
+	referer      string
+	plaintext    bool
+	decode       string
+	noRandomUA   bool
+	strict       bool
+	svcStrict    bool
+	explain      bool
+	checksumOnly bool
+	dedupe       bool
+	jsonPretty   bool
+	warnExpiring time.Duration
+	enrich       bool
+	config       string
+	servicesURL  string
+	configSHA256 string
+	ipVersion    string
+	sni          string
+	minTLS       string
+	maxIdleConns int
+	noKeepalive  bool
+	http2        bool
+	listDetailed bool
+	checkConfig  bool
+	diffConfig   bool
+	jitter       time.Duration
+	maxRequests  int64
+	env          string
+	output       string
+	maskReveal   int
+	probe        bool
+	validExit    int
+	invalidExit  int
+	errorExit    int
+	unknownExit  int
+	sarif        string
+	diff         string
+	instance     string
+	instanceURL  *url.URL
+	minSeverity  string
+	sortBy       string
+	tags         map[string]bool
+	profile      string
+	saveProfile  string
+	db           string
+	dbQuery      string
+	formatTmpl   *template.Template
+}
+
+var opts options
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func main() {
-	service, key, secret, jsonOutput, listServices, showHelp, showVersion, doUpdate := parseFlags()
-	if showHelp {
+	parseFlags()
+	if opts.debug {
+		log.SetLevel(log.DebugLevel)
+	}
+	if opts.showHelp {
 		displayHelp()
 		return
 	}
-	if showVersion {
+	if opts.showVersion {
 		displayVersion()
 		return
 	}
-	if doUpdate {
+	if opts.doUpdate {
 		performUpdate()
 		return
 	}
-	if listServices {
+	if opts.diffConfig {
+		source := opts.config
+		if source == "" {
+			source = opts.servicesURL
+		}
+		if !diffConfig(source) {
+			os.Exit(1)
+		}
+		return
+	}
+	if opts.checkConfig {
+		source := opts.config
+		if source == "" {
+			source = opts.servicesURL
+		}
+		if !validateConfig(source) {
+			os.Exit(1)
+		}
+		return
+	}
+	for _, source := range []string{opts.config, opts.servicesURL} {
+		if source == "" {
+			continue
+		}
+		if err := loadCustomConfig(source); err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to load config: "+err.Error()))
+			os.Exit(1)
+		}
+	}
+	opts.only = parseServiceList(opts.onlyList)
+	opts.skip = parseServiceList(opts.skipList + "," + opts.excludeList)
+	opts.tags = parseTags(opts.tagList)
+	if opts.listDetailed {
+		displayServicesDetailed()
+		return
+	}
+	if opts.listServices {
 		displayServices()
 		return
 	}
+	if opts.explain && opts.key == "" {
+		explainService(opts.service)
+		return
+	}
 
-	result := verifyAPIKey(service, key, secret)
-	if jsonOutput {
-		json.NewEncoder(os.Stdout).Encode(result)
-	} else {
-		displayResult(result)
+	if opts.db != "" {
+		if err := openHistory(opts.db); err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to open db: "+err.Error()))
+			os.Exit(1)
+		}
+		defer closeHistory()
+	}
+	if opts.dbQuery != "" {
+		entries, err := queryHistory(opts.dbQuery)
+		if err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to query db: "+err.Error()))
+			closeHistory()
+			os.Exit(1)
+		}
+		if opts.jsonOutput {
+			writeJSON(entries)
+		} else {
+			displayHistory(entries)
+		}
+		return
+	}
+
+	if opts.sshTunnel != "" {
+		client, err := openTunnel(opts.sshTunnel)
+		if err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to open ssh tunnel: "+err.Error()))
+			os.Exit(1)
+		}
+		tunnel = client
+		defer closeTunnel()
+	}
+	defer flushHAR()
+
+	if opts.diff != "" {
+		baseline, err := loadBaseline(opts.diff)
+		if err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to load baseline: "+err.Error()))
+			closeTunnel()
+			os.Exit(1)
+		}
+		baselineResults = baseline
 	}
-	if !result.Valid {
+
+	if err := resolveSecretFlags(context.Background()); err != nil {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to resolve secret: "+err.Error()))
+		closeTunnel()
 		os.Exit(1)
 	}
+
+	if opts.probe {
+		if !runProbe(context.Background()) {
+			flushHAR()
+			closeTunnel()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if batchMode() {
+		ctx := context.Background()
+		if opts.timeoutTotal > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.timeoutTotal)
+			defer cancel()
+		}
+		exitWith(runBatch(ctx))
+		return
+	}
+
+	if opts.watch > 0 {
+		runWatch()
+		return
+	}
+
+	if len(opts.secrets) > 1 {
+		exitWith(verifySecrets())
+		return
+	}
+
+	started := time.Now()
+	result := verifyAPIKey(context.Background(), opts.service, opts.key, opts.secret)
+	recordResult(result, opts.key)
+	switch {
+	case opts.jsonOutput && opts.diff != "":
+	case opts.jsonOutput && opts.envelope:
+		writeJSON(newBatchResult(started, []VerificationResult{result}, summarize([]VerificationResult{result}, "")))
+	case opts.jsonOutput:
+		writeJSON(result)
+	default:
+		displayResult(result)
+	}
+	reportRun([]VerificationResult{result})
+	if opts.rawResponse {
+		displayRawResponse(result, opts.key, opts.secret)
+	}
+	if opts.debugExport != "" {
+		if err := writeDebugExport(opts.debugExport, opts.service, result, opts.key, opts.secret); err != nil {
+			log.Error("Failed to write debug export", "error", err)
+		}
+	}
+	exitWith([]VerificationResult{result})
 }
 
-func parseFlags() (string, string, string, bool, bool, bool, bool, bool) {
-	service := flag.String("s", "", "service type")
-	key := flag.String("k", "", "api key")
-	secret := flag.String("secret", "", "secret key")
-	jsonOutput := flag.Bool("json", false, "json output")
-	listServices := flag.Bool("list", false, "list services")
-	showHelp := flag.Bool("h", false, "help")
-	showVersion := flag.Bool("version", false, "show version")
-	doUpdate := flag.Bool("update", false, "update to latest version")
+func parseFlags() {
+	flag.StringVar(&opts.service, "s", "", "service type")
+	flag.Var(&opts.keys, "k", "api key (repeatable)")
+	flag.Var(&opts.secrets, "secret", "secret key (repeatable)")
+	flag.StringVar(&opts.decode, "decode", "", "decode the key before verifying it: base64")
+	flag.StringVar(&opts.env, "env", "", "environment overrides to apply from a service's environments")
+	flag.StringVar(&opts.instance, "instance", "", "base url of a self-hosted instance to send requests to")
+	flag.StringVar(&opts.profile, "profile", "", "load flag defaults from a saved profile")
+	flag.StringVar(&opts.saveProfile, "save-profile", "", "save the flags of this run as a named profile")
+	flag.StringVar(&opts.config, "config", "", "services config file or http(s) url merged over the built-in services")
+	flag.StringVar(&opts.servicesURL, "services-from-url", "", "shared services config url merged over the built-in services")
+	flag.BoolVar(&opts.svcStrict, "services-strict", false, "fail instead of falling back when a remote config can't be fetched")
+	flag.StringVar(&opts.configSHA256, "config-sha256", "", "sha256 a remote services config must match")
+	flag.BoolVar(&opts.checkConfig, "validate-config", false, "validate -config (or the built-in services) against the schema")
+	flag.BoolVar(&opts.diffConfig, "diff-config", false, "compare -config with the built-in services")
+	flag.StringVar(&opts.file, "f", "", "file with keys to verify")
+	flag.BoolVar(&opts.all, "all", false, "verify key against all services")
+	flag.IntVar(&opts.concurrency, "c", 10, "concurrent verifications in batch mode")
+	flag.BoolVar(&opts.dedupe, "dedupe", false, "verify repeated service:key pairs once in batch mode")
+	flag.DurationVar(&opts.jitter, "jitter", 0, "random delay up to this long before each batch request, shuffles -all")
+	flag.BoolVar(&opts.failFast, "fail-fast", false, "stop batch at first invalid key")
+	flag.BoolVar(&opts.keepGoing, "keep-going", false, "accepted for compatibility, batches always carry on past errors")
+	flag.IntVar(&opts.count, "count", 0, "only verify the first n keys of a batch file")
+	flag.Int64Var(&opts.maxRequests, "max-requests", 0, "cap on outbound requests for the whole run, 0 for no limit")
+	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "timeout per request")
+	flag.DurationVar(&opts.timeoutTotal, "timeout-total", 0, "overall time budget for a batch")
+	minSeverity := flag.String("min-severity", "", "only show valid batch results at or above this severity")
+	sortBy := flag.String("sort", "", "order batch results by service, validity, severity or latency")
+	flag.BoolVar(&opts.summaryOnly, "summary", false, "only print batch summary")
+	flag.BoolVar(&opts.checksumOnly, "checksum-only", false, "check key format and checksum offline, no requests")
+	flag.Var(thresholdValue{&opts.warnExpiring}, "warn-expiring", "warn when a valid key expires within this window (e.g. 7d, 24h)")
+	flag.BoolVar(&opts.enrich, "enrich", false, "make extra requests for details like accessible models")
+	flag.BoolVar(&opts.strict, "strict", false, "require all response fields and no error field")
+	flag.BoolVar(&opts.jsonOutput, "json", false, "json output")
+	flag.BoolVar(&opts.probe, "probe", false, "send the request with a bogus key, without auth and as head/get, and compare the responses")
+	flag.IntVar(&opts.validExit, "valid-exit", 0, "exit code when every key is valid")
+	flag.IntVar(&opts.invalidExit, "invalid-exit", 1, "exit code when the worst outcome is an invalid key")
+	flag.IntVar(&opts.errorExit, "error-exit", 1, "exit code when the worst outcome is an error")
+	flag.IntVar(&opts.unknownExit, "unknown-exit", 1, "exit code when the worst outcome is unknown (skipped or manual)")
+	flag.BoolVar(&opts.includeReq, "include-request", false, "add the request method, redacted url and header names to json results")
+	flag.StringVar(&opts.sarif, "sarif", "", "write valid keys as sarif 2.1.0 findings to a file")
+	flag.StringVar(&opts.output, "o", "", "write the results as json to file")
+	flag.StringVar(&opts.diff, "diff", "", "compare results with a json file from an earlier -o run")
+	flag.IntVar(&opts.maskReveal, "mask-reveal", 4, "characters of the key shown at each end of masked keys, 0 to hide all")
+	flag.BoolVar(&opts.envelope, "json-envelope", false, "wrap single-key json in the batch document with summary and timestamps")
+	flag.BoolVar(&opts.jsonPretty, "json-pretty", false, "indented json output")
+	flag.StringVar(&opts.format, "format", "", "go template for each result")
+	flag.BoolVar(&opts.listServices, "list", false, "list services")
+	flag.BoolVar(&opts.listDetailed, "list-detailed", false, "list services with method, auth and inputs")
+	flag.BoolVar(&opts.explain, "explain", false, "describe how a service is verified, or why a key's result was reached")
+	flag.BoolVar(&opts.showHelp, "h", false, "help")
+	flag.BoolVar(&opts.showVersion, "version", false, "show version")
+	flag.BoolVar(&opts.doUpdate, "update", false, "update to latest version")
+	flag.StringVar(&opts.sessionToken, "session-token", "", "aws session token for temporary credentials")
+	flag.StringVar(&opts.stsEndpoint, "sts-endpoint", "", "custom sts endpoint url")
+	flag.StringVar(&opts.resolver, "resolver", "", "custom dns resolver (ip:port)")
+	flag.BoolVar(&opts.preferIPv6, "prefer-ipv6", false, "prefer ipv6 addresses")
+	flag.IntVar(&opts.maxIdleConns, "max-idle-conns", 0, "idle connections kept per host, 0 to follow -c")
+	flag.BoolVar(&opts.noKeepalive, "disable-keepalive", false, "open a new connection for every request")
+	flag.BoolVar(&opts.http2, "http2", true, "negotiate http/2 with servers that support it")
+	flag.StringVar(&opts.ipVersion, "ip-version", "auto", "ip version to connect with: 4, 6 or auto")
+	flag.BoolVar(&opts.plaintext, "insecure-allow-plaintext", false, "allow sending keys to http:// urls")
+	flag.StringVar(&opts.minTLS, "min-tls", "1.2", "minimum tls version: 1.2 or 1.3")
+	flag.StringVar(&opts.sni, "sni", "", "tls server name to send and verify the certificate against")
+	flag.StringVar(&opts.userAgent, "user-agent", "", "fixed user-agent for requests")
+	flag.BoolVar(&opts.noRandomUA, "no-random-ua", false, "use a static roq user-agent")
+	flag.StringVar(&opts.referer, "referer", "", "referer to send, overriding the service's")
+	flag.StringVar(&opts.sshTunnel, "ssh-tunnel", "", "route requests through an ssh bastion (user@host:port)")
+	flag.BoolVar(&opts.rawResponse, "raw-response", false, "print the raw response body")
+	flag.Int64Var(&opts.maxBody, "max-body", 4<<20, "max response bytes to read, 0 for no limit")
+	flag.BoolVar(&opts.debug, "debug", false, "print debug logs")
+	flag.IntVar(&opts.rawMax, "raw-max", 0, "max response bytes to print with -raw-response")
+	flag.StringVar(&opts.db, "db", "", "sqlite file to record results in")
+	flag.StringVar(&opts.dbQuery, "db-query", "", "list results recorded in -db for a service (or all)")
+	flag.StringVar(&opts.debugExport, "debug-export", "", "write a sanitized debug bundle to file")
+	flag.StringVar(&opts.har, "har", "", "record every request and response to a har file, keys redacted")
+	flag.DurationVar(&opts.watch, "watch", 0, "re-verify the key on an interval")
+	flag.BoolVar(&opts.watchVerbose, "watch-verbose", false, "print every watch check, not only changes")
+	flag.StringVar(&opts.webhook, "webhook", "", "post the json result to this url when -watch sees a change")
+	flag.StringVar(&opts.kubeconfig, "kubeconfig", "", "kubeconfig for k8s token reviews")
+	flag.StringVar(&opts.k8sServer, "k8s-server", "", "kubernetes api server url")
+	flag.StringVar(&opts.k8sCA, "k8s-ca", "", "kubernetes api server ca file")
+	flag.StringVar(&opts.onlyList, "only", "", "comma-separated services to include in batch")
+	flag.StringVar(&opts.skipList, "skip", "", "comma-separated services to exclude from batch")
+	flag.StringVar(&opts.excludeList, "exclude", "", "comma-separated services to exclude from batch, same as -skip")
+	flag.StringVar(&opts.tagList, "tag", "", "comma-separated tags, only services with one of them run in a batch")
 	flag.Parse()
 
-	if *showHelp {
-		return "", "", "", false, false, true, false, false
+	if opts.profile != "" {
+		if err := applyProfile(opts.profile); err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to load profile: "+err.Error()))
+			os.Exit(1)
+		}
+	}
+	if opts.saveProfile != "" {
+		path, err := saveProfile(opts.saveProfile)
+		if err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("failed to save profile: "+err.Error()))
+			os.Exit(1)
+		}
+		fmt.Printf("%s %s %s\n", successStyle.Render("✓"), "saved profile "+opts.saveProfile, dimStyle.Render(path))
+	}
+
+	if opts.resolver != "" {
+		if _, _, err := net.SplitHostPort(opts.resolver); err != nil {
+			opts.resolver = net.JoinHostPort(opts.resolver, "53")
+		}
+	}
+	if opts.jsonPretty {
+		opts.jsonOutput = true
+	}
+	if opts.ipVersion != "4" && opts.ipVersion != "6" && opts.ipVersion != "auto" {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -ip-version: "+opts.ipVersion+" (use 4, 6 or auto)"))
+		os.Exit(1)
+	}
+	if *minSeverity != "" {
+		severity, err := parseSeverity(*minSeverity)
+		if err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -min-severity: "+err.Error()))
+			os.Exit(1)
+		}
+		opts.minSeverity = severity
+	}
+	if *sortBy != "" {
+		order, err := parseSortOrder(*sortBy)
+		if err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -sort: "+err.Error()))
+			os.Exit(1)
+		}
+		opts.sortBy = order
+	}
+	if len(opts.keys) > 0 {
+		opts.key = opts.keys[0]
+	}
+	if len(opts.secrets) > 0 {
+		opts.secret = opts.secrets[0]
+	}
+
+	if opts.instance != "" {
+		instance := opts.instance
+		if !strings.Contains(instance, "://") {
+			instance = "https://" + instance
+		}
+		u, err := url.Parse(instance)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -instance: "+opts.instance+" (use https://host[:port][/path])"))
+			os.Exit(1)
+		}
+		opts.instanceURL = u
+	}
+
+	if opts.format != "" {
+		tmpl, err := template.New("format").Funcs(templateFuncs).Parse(opts.format)
+		if err != nil {
+			fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -format template: "+err.Error()))
+			os.Exit(1)
+		}
+		opts.formatTmpl = tmpl
+	}
+
+	if opts.minTLS != "1.2" && opts.minTLS != "1.3" {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -min-tls: "+opts.minTLS+" (use 1.2 or 1.3)"))
+		os.Exit(1)
+	}
+	if opts.decode != "" && opts.decode != "base64" {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -decode: "+opts.decode+" (use base64)"))
+		os.Exit(1)
+	}
+	if opts.servicesURL != "" && !isRemoteConfig(opts.servicesURL) {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -services-from-url: "+opts.servicesURL+" (use an http(s) url, or -config for a file)"))
+		os.Exit(1)
+	}
+
+	if opts.probe && batchMode() {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("-probe checks a single key, use -s and -k"))
+		os.Exit(1)
+	}
+	if opts.maskReveal < 0 {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -mask-reveal: "+strconv.Itoa(opts.maskReveal)+" (use 0 to hide the whole key)"))
+		os.Exit(1)
+	}
+	if opts.count < 0 {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("invalid -count: "+strconv.Itoa(opts.count)+" (use 0 for no limit)"))
+		os.Exit(1)
+	}
+	if err := checkExitCodes(); err != nil {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render(err.Error()))
+		os.Exit(1)
+	}
+
+	if opts.diffConfig && opts.config == "" && opts.servicesURL == "" {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("-diff-config needs -config or -services-from-url"))
+		os.Exit(1)
+	}
+
+	if opts.dbQuery != "" && opts.db == "" {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("-db-query needs -db"))
+		os.Exit(1)
 	}
-	if *showVersion {
-		return "", "", "", false, false, false, true, false
+
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
 	}
-	if *doUpdate {
-		return "", "", "", false, false, false, false, true
+	if opts.showHelp || opts.showVersion || opts.doUpdate || opts.listServices || opts.listDetailed || opts.checkConfig || opts.diffConfig || opts.dbQuery != "" || opts.file != "" {
+		return
 	}
-	if *listServices {
-		return "", "", "", false, true, false, false, false
+	if opts.explain && opts.service != "" && opts.key == "" {
+		return
 	}
-	if *service == "" || *key == "" {
+	if opts.key == "" || (opts.service == "" && !opts.all) {
+		if opts.saveProfile != "" {
+			os.Exit(0)
+		}
 		displayHelp()
 		os.Exit(0)
 	}
-	return *service, *key, *secret, *jsonOutput, false, false, false, false
 }
 
 func displayHelp() {
@@ -159,29 +714,159 @@ func displayHelp() {
 	argStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
 	flagStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("15"))
 	requiredStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
-	
+
 	fmt.Println()
 	fmt.Println(successStyle.Render(" example:"))
 	fmt.Printf("    %s -s %s -k %s\n", cmdStyle.Render("roq"), argStyle.Render("github"), argStyle.Render("ghp_xxxxxxxxxxxx"))
-	fmt.Printf("    %s -s %s -json\n\n", cmdStyle.Render("roq"), argStyle.Render("trello"))
-	
+	fmt.Printf("    %s -s %s -json\n", cmdStyle.Render("roq"), argStyle.Render("trello"))
+	fmt.Printf("    %s -f %s -fail-fast\n\n", cmdStyle.Render("roq"), argStyle.Render("keys.txt"))
+
+	helpOptions := [][3]string{
+		{"-s", "service type", "(required)"},
+		{"-k", "api key to verify; repeat to verify several against -s", "(required)"},
+		{"-secret", "secret key, env:VAR or secretsmanager:id#field; repeat to test several", "(required for aws)"},
+		{"-config", "services yaml file or http(s) url, merged over the built-in services", ""},
+		{"-services-from-url", "shared services config url, cached for an hour; http:// needs -insecure-allow-plaintext", ""},
+		{"-services-strict", "fail instead of falling back to the built-in services when a remote config can't be fetched", ""},
+		{"-config-sha256", "pin a remote services config to this sha256", ""},
+		{"-instance", "base url of a self-hosted instance (e.g. https://jira.example.com), replaces the service host", ""},
+		{"-decode", "decode a base64 key (e.g. base64 of user:pass) before verifying it", ""},
+		{"-env", "apply a service's environments overrides (e.g. staging)", ""},
+		{"-validate-config", "check -config (or the built-in services) against the schema and exit", ""},
+		{"-diff-config", "show which services -config adds to or changes in the built-in set, field by field", ""},
+		{"-profile", "load flag defaults from a profile in ~/.config/roq/profiles.yaml", ""},
+		{"-save-profile", "save this run's flags (keys and secrets excluded) as a named profile", ""},
+		{"-f", "file with keys, one per line (service:key without -s, - for stdin), or a .csv with service,key,secret", ""},
+		{"-all", "verify the key against all services", ""},
+		{"-c", "concurrent verifications in batch mode (default 10)", ""},
+		{"-dedupe", "verify repeated service:key pairs once and reuse the result", ""},
+		{"-jitter", "random delay up to this long before each batch request; -all also runs in random order", ""},
+		{"-fail-fast", "stop batch at the first invalid key", ""},
+		{"-keep-going", "no-op, batches always record malformed lines and failed checks as errored and carry on", ""},
+		{"-count", "only verify the first n keys from -f or stdin", ""},
+		{"-max-requests", "cap on outbound requests for the whole run; keys left when it runs out are skipped", ""},
+		{"-max-body", "max response bytes to read before giving up (default 4MB, 0 for no limit)", ""},
+		{"-debug", "print debug logs, such as responses cut off by -max-body", ""},
+		{"-timeout", "timeout per request (default 10s)", ""},
+		{"-timeout-total", "overall time budget for a batch, unchecked keys are skipped", ""},
+		{"-min-severity", "only list valid batch results at or above low, medium, high or critical", ""},
+		{"-sort", "order batch results by service, validity, severity (highest first) or latency (slowest first)", ""},
+		{"-summary", "only print the batch totals and per-service breakdown", ""},
+		{"-only", "comma-separated services to include in batch", ""},
+		{"-skip", "comma-separated services to exclude from batch (wins over -only)", ""},
+		{"-exclude", "same as -skip", ""},
+		{"-tag", "comma-separated tags (e.g. cloud,ai), only services with one of them run in a batch or -list", ""},
+		{"-session-token", "aws session token for temporary (ASIA...) credentials", ""},
+		{"-sts-endpoint", "custom sts endpoint url (vpc endpoints, emulators)", ""},
+		{"-resolver", "custom dns resolver for requests (ip:port)", ""},
+		{"-prefer-ipv6", "try ipv6 addresses before ipv4", ""},
+		{"-max-idle-conns", "idle connections kept per host for reuse (default follows -c)", ""},
+		{"-disable-keepalive", "open a new connection for every request", ""},
+		{"-http2", "negotiate http/2 where supported, -http2=false for http/1.1 only (default true)", ""},
+		{"-ip-version", "connect over ipv4 or ipv6 only: 4, 6 or auto (default auto)", ""},
+		{"-insecure-allow-plaintext", "allow sending keys to plain http:// urls (refused by default, localhost excepted)", ""},
+		{"-min-tls", "minimum tls version to negotiate: 1.2 or 1.3 (default 1.2)", ""},
+		{"-sni", "tls server name to send and verify the certificate against, for hosts reached by ip", ""},
+		{"-user-agent", "fixed user-agent instead of a random one", ""},
+		{"-no-random-ua", "use a static roq/version user-agent", ""},
+		{"-referer", "referer to send, for keys restricted to a website (overrides the service's referer)", ""},
+		{"-ssh-tunnel", "route requests through an ssh bastion (user@host:port)", ""},
+		{"-raw-response", "print the raw response body, key redacted (single key only)", ""},
+		{"-raw-max", "max response bytes to print with -raw-response", ""},
+		{"-db", "sqlite file that records every result with a hashed key", ""},
+		{"-db-query", "list results recorded in -db for a service, or all", ""},
+		{"-debug-export", "write a sanitized debug bundle (config, request, response) to file", ""},
+		{"-har", "record every request and response to a har file, keys redacted", ""},
+		{"-watch", "re-verify on an interval (e.g. 30s) and print status changes", ""},
+		{"-watch-verbose", "print every -watch check, not only changes", ""},
+		{"-webhook", "post the json result to a url when -watch sees the key change state", ""},
+		{"-kubeconfig", "kubeconfig used to review kubernetes tokens (default ~/.kube/config)", ""},
+		{"-k8s-server", "kubernetes api server url", ""},
+		{"-k8s-ca", "kubernetes api server ca file", ""},
+		{"-checksum-only", "check key format and embedded checksum offline, without any request", ""},
+		{"-warn-expiring", "warn when a valid key expires within this window (e.g. 7d, 24h)", ""},
+		{"-enrich", "make extra requests for details such as accessible models (openai, anthropic)", ""},
+		{"-strict", "require every response field and no error field before reporting valid", ""},
+		{"-format", "go template rendered for each result, e.g. '{{.Service}}: {{.Valid}}'", ""},
+		{"-o", "write the results as json to a file, usable as a -diff baseline", ""},
+		{"-sarif", "write valid keys as sarif 2.1.0 findings to a file", ""},
+		{"-include-request", "add the request sent (method, url with the key masked, header names) to json results", ""},
+		{"-valid-exit", "exit code when every key is valid (default 0)", ""},
+		{"-invalid-exit", "exit code when the worst outcome is an invalid key (default 1)", ""},
+		{"-error-exit", "exit code when the worst outcome is an error (default 1)", ""},
+		{"-unknown-exit", "exit code when the worst outcome is unknown: skipped or manual-only (default 1)", ""},
+		{"-diff", "report keys that changed state since a baseline json file", ""},
+		{"-json", "output in json format", ""},
+		{"-json-pretty", "indented json output (implies -json)", ""},
+		{"-mask-reveal", "characters shown at each end of masked keys (default 4, 0 hides all, never more than a quarter each)", ""},
+		{"-json-envelope", "wrap single-key json in the batch document (summary, timestamps, version)", ""},
+		{"-list", "list all supported services", ""},
+		{"-list-detailed", "list services with method, auth, secret and key format", ""},
+		{"-explain", "describe how the -s service is verified; with -k, show why the result is valid or invalid", ""},
+		{"-probe", "send the request as configured, with a bogus key, without auth and as head/get, and compare the responses (single key only)", ""},
+		{"-version", "show version, commit and build date; with -json for scripts", ""},
+		{"-update", "update to latest version", ""},
+		{"-h", "show this help message", ""},
+	}
+	width := 0
+	for _, opt := range helpOptions {
+		if len(opt[0]) > width {
+			width = len(opt[0])
+		}
+	}
+
 	fmt.Println(successStyle.Render(" options:"))
-	fmt.Printf("    %s       service type %s\n", flagStyle.Render("-s"), requiredStyle.Render("(required)"))
-	fmt.Printf("    %s       api key to verify %s\n", flagStyle.Render("-k"), requiredStyle.Render("(required)"))
-	fmt.Printf("    %s  secret key %s\n", flagStyle.Render("-secret"), argStyle.Render("(required for aws)"))
-	fmt.Printf("    %s    output in json format\n", flagStyle.Render("-json"))
-	fmt.Printf("    %s    list all supported services\n", flagStyle.Render("-list"))
-	fmt.Printf("    %s show version\n", flagStyle.Render("-version"))
-	fmt.Printf("    %s  update to latest version\n", flagStyle.Render("-update"))
-	fmt.Printf("    %s       show this help message\n\n", flagStyle.Render("-h"))
-	
+	for _, opt := range helpOptions {
+		note := ""
+		if opt[2] == "(required)" {
+			note = " " + requiredStyle.Render(opt[2])
+		} else if opt[2] != "" {
+			note = " " + argStyle.Render(opt[2])
+		}
+		fmt.Printf("    %s %s%s\n", flagStyle.Render(fmt.Sprintf("%-*s", width, opt[0])), opt[1], note)
+	}
+	fmt.Println()
+
 	fmt.Println(argStyle.Render("use responsibly and only on authorized targets!"))
 	fmt.Println()
 }
 
+type VersionInfo struct {
+	Version string `json:"version"`
+	Go      string `json:"go"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+func buildInfo() VersionInfo {
+	info := VersionInfo{Version: version, Go: runtime.Version(), Commit: commit, Date: buildDate}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value[:min(12, len(setting.Value))]
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "dev"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
 func displayVersion() {
+	info := buildInfo()
+	if opts.jsonOutput {
+		writeJSON(info)
+		return
+	}
 	fmt.Println()
-	fmt.Printf("%s %s\n", highlightStyle.Render("roq"), dimStyle.Render("v"+version))
+	fmt.Printf("%s %s %s\n", highlightStyle.Render("roq"), dimStyle.Render("v"+info.Version), dimStyle.Render("("+info.Commit+", built "+info.Date+", "+info.Go+")"))
 	fmt.Println()
 }
 
@@ -245,223 +930,1271 @@ func displayServices() {
 	fmt.Println(highlightStyle.Render("supported services:"))
 	fmt.Println()
 	for serviceName, serviceConfig := range servicesConfig.Services {
+		if !serviceTagged(serviceConfig) {
+			continue
+		}
 		secretInfo := ""
 		if serviceConfig.RequiresSecret {
 			secretInfo = dimStyle.Render(" (requires secret)")
 		}
-		fmt.Printf("  • %s - %s%s\n", serviceName, serviceConfig.Name, secretInfo)
+		aliasInfo := ""
+		if len(serviceConfig.Aliases) > 0 {
+			aliasInfo = dimStyle.Render(" (aliases: " + strings.Join(serviceConfig.Aliases, ", ") + ")")
+		}
+		fmt.Printf("  • %s - %s%s%s\n", serviceName, serviceConfig.Name, secretInfo, aliasInfo)
 	}
 	fmt.Println()
 }
 
+func verifySecrets() []VerificationResult {
+	started := time.Now()
+	results := make([]VerificationResult, 0, len(opts.secrets))
+	for _, secret := range opts.secrets {
+		result := verifyAPIKey(context.Background(), opts.service, opts.key, secret)
+		result.Secret = maskKey(normalizeKey(secret, false))
+		recordResult(result, opts.key)
+		results = append(results, result)
+	}
+
+	switch {
+	case opts.jsonOutput && opts.envelope:
+		writeJSON(newBatchResult(started, results, summarize(results, "")))
+	case opts.jsonOutput:
+		writeJSON(results)
+	default:
+		for _, result := range results {
+			displayResult(result)
+		}
+	}
+	for _, result := range results {
+		if result.Valid {
+			return []VerificationResult{result}
+		}
+	}
+	return results
+}
+
 func displayResult(result VerificationResult) {
+	if opts.formatTmpl != nil {
+		displayFormatted(result)
+		return
+	}
 	fmt.Println()
 	if result.Valid {
 		fmt.Printf("%s %s\n", successStyle.Render("✓"), strings.ToLower(result.Service))
+		if result.Secret != "" {
+			fmt.Printf("  %s\n", dimStyle.Render("secret: "+result.Secret))
+		}
 		if result.Details != "" {
 			fmt.Printf("  %s\n", dimStyle.Render(strings.ToLower(result.Details)))
 		}
+		if len(result.Scopes) > 0 {
+			fmt.Printf("  %s\n", dimStyle.Render("scopes: "+strings.Join(result.Scopes, ", ")))
+		}
+		if result.Mode != "" {
+			fmt.Printf("  %s\n", modeStyle(result.Mode).Render("mode: "+result.Mode))
+		}
+		if result.Region != "" {
+			fmt.Printf("  %s\n", dimStyle.Render("region: "+result.Region))
+		}
+		if result.Severity != "" {
+			fmt.Printf("  %s\n", severityStyle(result.Severity).Render("severity: "+result.Severity))
+		}
+		if result.ExpiringSoon {
+			fmt.Printf("  %s\n", warnStyle.Render("⚠ "+expiryWarning(result)))
+		} else if result.ExpiresAt != "" {
+			fmt.Printf("  %s\n", dimStyle.Render("expires: "+result.ExpiresAt))
+		}
+		if result.Warning != "" {
+			fmt.Printf("  %s\n", warnStyle.Render("⚠ "+result.Warning))
+		}
+		if result.Reason != "" {
+			fmt.Printf("  %s\n", dimStyle.Render("why: "+result.Reason))
+		}
 	} else {
 		fmt.Printf("%s %s\n", errorStyle.Render("✗"), strings.ToLower(result.Service))
+		if result.Secret != "" {
+			fmt.Printf("  %s\n", dimStyle.Render("secret: "+result.Secret))
+		}
 		fmt.Printf("  %s\n", dimStyle.Render(strings.ToLower(result.Message)))
+		if result.Details != "" {
+			fmt.Printf("  %s\n", dimStyle.Render(result.Details))
+		}
+		if result.Warning != "" {
+			fmt.Printf("  %s\n", warnStyle.Render("⚠ "+result.Warning))
+		}
+		if result.Reason != "" {
+			fmt.Printf("  %s\n", dimStyle.Render("why: "+result.Reason))
+		}
 	}
 	fmt.Println()
 }
 
-func verifyAPIKey(service, key, secret string) VerificationResult {
-	serviceConfig, exists := servicesConfig.Services[strings.ToLower(service)]
+func writeJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	if opts.jsonPretty {
+		encoder.SetIndent("", "  ")
+	}
+	encoder.Encode(v)
+}
+
+func displayFormatted(result VerificationResult) {
+	var buf bytes.Buffer
+	if err := opts.formatTmpl.Execute(&buf, result); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s\n", errorStyle.Render("✗"), dimStyle.Render("format error: "+err.Error()))
+		return
+	}
+	out := buf.String()
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	fmt.Print(out)
+}
+
+func displayRawResponse(result VerificationResult, key, secret string) {
+	body := result.rawResponse
+	truncated := false
+	if opts.rawMax > 0 && len(body) > opts.rawMax {
+		body = body[:opts.rawMax]
+		truncated = true
+	}
+
+	raw := redact(string(body), redactionSet(normalizeKey(key, true), normalizeKey(secret, false))...)
+	if truncated {
+		raw += "\n" + dimStyle.Render(fmt.Sprintf("... truncated at %d bytes", opts.rawMax))
+	}
+	if raw == "" {
+		raw = dimStyle.Render("(empty)")
+	}
+	fmt.Fprintln(os.Stderr, highlightStyle.Render("response:"))
+	fmt.Fprintln(os.Stderr, raw)
+	fmt.Fprintln(os.Stderr)
+}
+
+func redact(text string, values ...string) string {
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			text = strings.ReplaceAll(text, value, maskKey(value))
+		}
+	}
+	return text
+}
+
+func verifyAPIKey(ctx context.Context, service, key, secret string) VerificationResult {
+	service = resolveService(service)
+	serviceConfig, exists := servicesConfig.Services[service]
 	if !exists {
 		return VerificationResult{
 			Service:   strings.ToLower(service),
 			Valid:     false,
 			Message:   fmt.Sprintf("unsupported service: %s", service),
+			Errored:   true,
 			Timestamp: time.Now().Format(time.RFC3339),
 		}
 	}
 
+	serviceConfig = applyEnvironment(serviceConfig, opts.env)
+	key = normalizeKey(key, serviceConfig.StripPrefix)
+	secret = normalizeKey(secret, false)
+	redactCredentials(key, secret)
+
 	result := VerificationResult{
 		Service:   strings.ToLower(serviceConfig.Name),
 		Key:       maskKey(key),
+		ID:        keyID(key),
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
 
-	switch serviceConfig.Method {
-	case "GET", "POST":
-		return verifyHTTP(serviceConfig, key, result)
-	case "SDK":
-		if serviceConfig.SDKType == "aws" {
-			return verifyAWS(key, secret, result)
+	encoding := serviceConfig.KeyEncoding
+	if opts.decode != "" {
+		encoding = opts.decode
+	}
+	if encoding != "" {
+		decoded, err := decodeKey(key, encoding)
+		if err != nil {
+			result.Valid = false
+			result.Errored = true
+			result.Message = err.Error()
+			return result
 		}
-	case "MANUAL":
-		result.Valid = false
-		result.Message = strings.ToLower(serviceConfig.Message)
-		result.Details = strings.ToLower(serviceConfig.Details)
-		return result
+		key = normalizeKey(decoded, serviceConfig.StripPrefix)
+		if user, pass, ok := strings.Cut(key, ":"); ok && serviceConfig.RequiresSecret && secret == "" {
+			key, secret = user, pass
+		}
+		redactCredentials(key, secret)
 	}
-
-	result.Valid = false
-	result.Message = "verification method not implemented"
-	return result
+	return rateSeverity(serviceConfig, dispatchVerify(ctx, service, serviceConfig, key, secret, result))
 }
 
-func verifyHTTP(serviceConfig ServiceConfig, key string, result VerificationResult) VerificationResult {
-	url := renderTemplate(serviceConfig.URL, map[string]string{"Key": key})
-	req, err := http.NewRequest(serviceConfig.Method, url, nil)
-	if err != nil {
-		result.Valid = false
-		result.Message = "failed to create request"
-		return result
+func dispatchVerify(ctx context.Context, service string, serviceConfig ServiceConfig, key, secret string, result VerificationResult) VerificationResult {
+	if opts.checksumOnly {
+		return verifyOffline(service, key, result)
 	}
 
-	for headerKey, headerValue := range serviceConfig.Headers {
-		rendered := renderTemplate(headerValue, map[string]string{
-			"Key":       key,
-			"UserAgent": uarand.GetRandom(),
-		})
-		req.Header.Set(headerKey, rendered)
+	if serviceConfig.SDKType == "aws" && secret == "" && !awsAccessKeyFormat(key) {
+		result.Valid = false
+		result.Message = "invalid aws access key format"
+		result.Details = "expected AKIA... or ASIA... followed by 16 characters"
+		result.ReasonCode = "invalid_format"
+		return result
 	}
 
-	if serviceConfig.AuthType == "basic" {
-		authUser := renderTemplate(serviceConfig.AuthUser, map[string]string{"Key": key})
-		authPass := renderTemplate(serviceConfig.AuthPass, map[string]string{"Key": key})
-		req.SetBasicAuth(authUser, authPass)
+	if serviceConfig.RequiresSecret && secret == "" {
+		return missingSecret(service, serviceConfig, key, result)
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
+	if note := matchPrefix(serviceConfig.ManualPrefixes, key); note != "" {
 		result.Valid = false
-		result.Message = "request failed: " + err.Error()
+		result.ReasonCode = "manual_check"
+		result.Message = strings.ToLower(note)
+		if keyType := matchPrefix(serviceConfig.KeyPrefixes, key); keyType != "" {
+			result.Details = "type: " + keyType + " token"
+		}
 		return result
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == serviceConfig.SuccessStatus {
-		if serviceConfig.ResponseType == "json" && len(serviceConfig.ResponseFields) > 0 {
-			body, _ := io.ReadAll(resp.Body)
-			var jsonResp map[string]interface{}
-			if err := json.Unmarshal(body, &jsonResp); err == nil {
-				if serviceConfig.ErrorField != "" {
-					if errMsg, ok := jsonResp[serviceConfig.ErrorField].(string); ok && errMsg != "" {
-						result.Valid = false
-						result.Message = strings.ToLower(errMsg)
-						return result
-					}
-				}
-				
-				if serviceConfig.SuccessField != "" {
-					if ok, exists := jsonResp[serviceConfig.SuccessField].(bool); exists && ok {
-						result.Valid = true
-						result.Message = "valid"
-						if serviceConfig.DetailsFormat != "" {
-							result.Details = renderTemplate(serviceConfig.DetailsFormat, flattenJSON(jsonResp))
-						}
-					} else {
-						result.Valid = false
-						result.Message = "invalid key"
-					}
-				} else {
-					flattened := flattenJSON(jsonResp)
-					hasData := false
-					for _, field := range serviceConfig.ResponseFields {
-						if _, exists := flattened[field]; exists {
-							hasData = true
-							break
-						}
-					}
-					
-					if hasData {
-						result.Valid = true
-						result.Message = "valid"
-						if serviceConfig.DetailsFormat != "" {
-							result.Details = renderTemplate(serviceConfig.DetailsFormat, flattened)
-						}
-					} else {
-						result.Valid = false
-						result.Message = "invalid key"
-					}
-				}
-			} else {
-				result.Valid = false
-				result.Message = "invalid response format"
-			}
-		} else {
-			result.Valid = true
-			result.Message = "valid"
-		}
+	if serviceConfig.VerifierCommand != "" {
+		return verifyCommand(ctx, serviceConfig, key, secret, result)
 	}
 
-	if resp.StatusCode != serviceConfig.SuccessStatus {
+	switch serviceConfig.Method {
+	case "GET", "POST", "STEPS":
+		return verifyRegions(ctx, serviceConfig, key, secret, result)
+	case "SDK":
+		switch serviceConfig.SDKType {
+		case "aws":
+			return verifyAWS(ctx, key, secret, result)
+		case "k8s":
+			return verifyK8s(ctx, key, result)
+		}
+	case "HMAC_VERIFY":
+		return verifyHMAC(serviceConfig, key, secret, result)
+	case "IMAP", "SMTP":
+		return verifyMail(ctx, serviceConfig, key, secret, result)
+	case "MANUAL":
 		result.Valid = false
-		result.Message = fmt.Sprintf("invalid (http %d)", resp.StatusCode)
+		result.ReasonCode = "manual_check"
+		result.Message = strings.ToLower(serviceConfig.Message)
+		result.Details = strings.ToLower(serviceConfig.Details)
+		return result
 	}
 
+	result.Valid = false
+	result.Errored = true
+	result.Message = "verification method not implemented"
 	return result
 }
 
-func renderTemplate(tmpl string, data map[string]string) string {
-	t, err := template.New("tmpl").Parse(tmpl)
-	if err != nil {
-		return tmpl
+func missingSecret(service string, serviceConfig ServiceConfig, key string, result VerificationResult) VerificationResult {
+	name := secretLabel(serviceConfig)
+	sample := "KEY"
+	if len(key) > 8 {
+		sample = key[:4] + "..."
 	}
-	var buf bytes.Buffer
-	if err := t.Execute(&buf, data); err != nil {
-		return tmpl
+	usage := fmt.Sprintf("use: roq -s %s -k %s -secret YOUR_%s", strings.ToLower(service), sample, strings.ToUpper(strings.ReplaceAll(name, " ", "_")))
+	if serviceConfig.SDKType == "aws" && strings.HasPrefix(key, "ASIA") {
+		usage += " -session-token YOUR_SESSION_TOKEN"
 	}
-	return buf.String()
-}
 
-func flattenJSON(data map[string]interface{}) map[string]string {
-	result := make(map[string]string)
-	for key, value := range data {
-		switch v := value.(type) {
-		case string:
-			result[key] = v
-		case map[string]interface{}:
-			for subKey, subValue := range v {
-				if str, ok := subValue.(string); ok {
-					result[key+"."+subKey] = str
-				}
-			}
-		default:
-			result[key] = fmt.Sprintf("%v", v)
-		}
-	}
+	result.Valid = false
+	result.Message = name + " required"
+	result.Details = usage
+	result.ReasonCode = "missing_secret"
 	return result
 }
 
-func verifyAWS(accessKey, secretKey string, result VerificationResult) VerificationResult {
-	if secretKey == "" {
-		if strings.HasPrefix(accessKey, "AKIA") && len(accessKey) == 20 {
+func awsAccessKeyFormat(key string) bool {
+	return len(key) == 20 && (strings.HasPrefix(key, "AKIA") || strings.HasPrefix(key, "ASIA"))
+}
+
+func secretLabel(serviceConfig ServiceConfig) string {
+	if serviceConfig.SecretName == "" {
+		return "secret"
+	}
+	return serviceConfig.SecretName
+}
+
+func verifyRegions(ctx context.Context, serviceConfig ServiceConfig, key, secret string, result VerificationResult) VerificationResult {
+	if len(serviceConfig.Regions) == 0 {
+		return verifyHTTP(ctx, serviceConfig, key, secret, result)
+	}
+	var first VerificationResult
+	for i, region := range serviceConfig.Regions {
+		regional := serviceConfig
+		regional.Region = region
+		attempt := verifyHTTP(ctx, regional, key, secret, result)
+		if attempt.Valid {
+			attempt.Region = region
+			return attempt
+		}
+		if attempt.Skipped || ctx.Err() != nil {
+			return attempt
+		}
+		if i == 0 {
+			first = attempt
+		}
+	}
+	return first
+}
+
+func verifyHTTP(ctx context.Context, serviceConfig ServiceConfig, key, secret string, result VerificationResult) VerificationResult {
+	steps := serviceConfig.Steps
+	if len(steps) == 0 {
+		steps = []ServiceConfig{serviceConfig}
+	}
+
+	data := templateData(key, secret)
+	if serviceConfig.Region != "" {
+		data["Region"] = serviceConfig.Region
+	}
+	vars := make(map[string]string)
+	if keyType := matchPrefix(serviceConfig.KeyPrefixes, key); keyType != "" {
+		data["KeyType"] = keyType
+		vars["KeyType"] = keyType
+	}
+	if mode := matchPrefix(serviceConfig.ModeFromPrefix, key); mode != "" {
+		data["Mode"] = mode
+		vars["Mode"] = mode
+		result.Mode = mode
+	}
+
+	var slowest time.Duration
+	for i, step := range steps {
+		started := time.Now()
+		data["UUID"] = uuid.NewString()
+		resp, body, err := sendRequest(ctx, step, data)
+		slowest = max(slowest, time.Since(started))
+		if opts.debugExport != "" {
+			result.trace = append(result.trace, newRequestTrace(step, data, resp, body, err))
+		}
+		if errors.Is(err, errRequestBudget) {
+			result.Valid = false
+			result.Skipped = true
+			result.Message = "skipped: " + err.Error()
+			result.ReasonCode = "request_budget"
+			return result
+		}
+		if opts.includeReq {
+			result.Request = describeRequest(step, data, resp, key, secret)
+		}
+		if err != nil {
+			result.Valid = false
+			result.Errored = true
+			result.Message = err.Error()
+			result.ReasonCode = "request_failed"
+			if errors.Is(err, errPlaintext) {
+				result.ReasonCode = "plaintext_refused"
+				result.Details = strings.ToLower(serviceConfig.PlaintextNote)
+			}
+			return result
+		}
+		result.rawResponse = body
+		result.Endpoint = resp.Request.URL.Host
+		if expiry := extractExpiry(step, resp.StatusCode, resp.Header, body); expiry != "" {
+			result.ExpiresAt = expiry
+		}
+
+		if i == len(steps)-1 {
+			result = evaluateResponse(step, resp.StatusCode, body, vars, result)
+			if result.Valid {
+				result.Scopes = extractScopes(step, resp.Header, body)
+				if opts.enrich {
+					result = enrichResult(ctx, serviceConfig, data, vars, result)
+				}
+			}
+			if serviceConfig.MaxLatency > 0 && slowest > serviceConfig.MaxLatency {
+				result.warn("slow response: %s (max_latency %s)", slowest.Round(time.Millisecond), serviceConfig.MaxLatency)
+			}
+			return markExpiring(result)
+		}
+
+		extracted, message := extractStep(step, resp.StatusCode, resp.Header, body)
+		if message != "" {
+			if step.Optional {
+				continue
+			}
+			result.Valid = false
+			result.Message = fmt.Sprintf("%s (step %d)", message, i+1)
+			result.ReasonCode = "step_failed"
+			return result
+		}
+		for name, value := range extracted {
+			data[name] = value
+			vars[name] = value
+		}
+	}
+
+	return result
+}
+
+func enrichResult(ctx context.Context, serviceConfig ServiceConfig, data, vars map[string]string, result VerificationResult) VerificationResult {
+	for i, step := range serviceConfig.Enrich {
+		data["UUID"] = uuid.NewString()
+		resp, body, err := sendRequest(ctx, step, data)
+		if err != nil || !step.SuccessStatus.Match(resp.StatusCode) {
+			continue
+		}
+		var jsonResp map[string]interface{}
+		if err := json.Unmarshal(body, &jsonResp); err != nil && step.ResponseType == "json" {
+			result.warn("enrich step %d: invalid response format", i+1)
+			continue
+		}
+		flattened := flattenJSON(jsonResp)
+		for name := range resp.Header {
+			flattened["header."+strings.ToLower(name)] = resp.Header.Get(name)
+		}
+		details := renderDetails(step.DetailsFormat, flattened, vars)
+		if details == "" {
+			continue
+		}
+		if result.Details != "" {
+			result.Details += ", "
+		}
+		result.Details += details
+	}
+	return result
+}
+
+func extractStep(step ServiceConfig, statusCode int, header http.Header, body []byte) (map[string]string, string) {
+	if !step.SuccessStatus.Match(statusCode) {
+		return nil, fmt.Sprintf("invalid (http %d)", statusCode)
+	}
+	if len(step.Extract) == 0 && len(step.ExtractRegex) == 0 && len(step.ExtractHeader) == 0 {
+		return nil, ""
+	}
+
+	extracted := make(map[string]string, len(step.Extract)+len(step.ExtractRegex)+len(step.ExtractHeader))
+	for name, headerName := range step.ExtractHeader {
+		value := header.Get(headerName)
+		if value == "" {
+			return nil, "missing " + strings.ToLower(headerName) + " header in response"
+		}
+		extracted[name] = value
+	}
+	if len(step.Extract) > 0 {
+		var jsonResp map[string]interface{}
+		if err := json.Unmarshal(body, &jsonResp); err != nil {
+			return nil, "invalid response format"
+		}
+		flattened := flattenJSON(jsonResp)
+		for name, field := range step.Extract {
+			value, exists := flattened[field]
+			if !exists {
+				return nil, "missing " + field + " in response"
+			}
+			extracted[name] = value
+		}
+	}
+	for name, pattern := range step.ExtractRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, "invalid extract_regex for " + name
+		}
+		match := re.FindSubmatch(body)
+		if match == nil {
+			return nil, "no match for " + name + " in response"
+		}
+		value := match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+		extracted[name] = string(value)
+	}
+	return extracted, ""
+}
+
+func matchPrefix(prefixes map[string]string, key string) string {
+	match := ""
+	for prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return ""
+	}
+	return prefixes[match]
+}
+
+func userAgent() string {
+	if opts.userAgent != "" {
+		return opts.userAgent
+	}
+	if opts.noRandomUA {
+		return "roq/" + version
+	}
+	return uarand.GetRandom()
+}
+
+func sendRequest(ctx context.Context, serviceConfig ServiceConfig, data map[string]string) (*http.Response, []byte, error) {
+	url := requestURL(serviceConfig, data)
+	payload := renderTemplate(serviceConfig.Body, data)
+	contentType := ""
+	if serviceConfig.BodyType == "multipart" {
+		var err error
+		if payload, contentType, err = multipartBody(serviceConfig, data); err != nil {
+			return nil, nil, fmt.Errorf("failed to build multipart body: %s", err.Error())
+		}
+	}
+	var body io.Reader
+	if payload != "" {
+		body = strings.NewReader(payload)
+	}
+	timeout := opts.timeout
+	if serviceConfig.Timeout > 0 {
+		timeout = serviceConfig.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, serviceConfig.Method, url, body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request")
+	}
+	if err := checkPlaintext(req.URL); err != nil {
+		return nil, nil, err
+	}
+
+	headerData := make(map[string]string, len(data)+3)
+	for k, v := range data {
+		headerData[k] = v
+	}
+	headerData["UserAgent"] = userAgent()
+	headerData["Host"] = req.URL.Host
+	headerData["Scheme"] = req.URL.Scheme
+	now := requestTime(ctx, serviceConfig, req.URL)
+	headerData["Timestamp"] = formatTimestamp(now, serviceConfig.TimestampFormat)
+	headerData["UnixTime"] = strconv.FormatInt(now.Unix(), 10)
+	if serviceConfig.AuthType == "hmac" {
+		headerData["Method"] = req.Method
+		headerData["Path"] = req.URL.RequestURI()
+		headerData["Body"] = payload
+	}
+	for headerKey, headerValue := range serviceConfig.Headers {
+		req.Header.Set(headerKey, renderTemplate(headerValue, headerData))
+	}
+	referer := renderTemplate(serviceConfig.Referer, headerData)
+	if opts.referer != "" {
+		referer = opts.referer
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	if serviceConfig.Origin != "" {
+		req.Header.Set("Origin", renderTemplate(serviceConfig.Origin, headerData))
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for cookieName, cookieValue := range serviceConfig.Cookies {
+		req.AddCookie(&http.Cookie{Name: cookieName, Value: renderTemplate(cookieValue, data)})
+	}
+
+	if serviceConfig.AuthType == "basic" {
+		authUser := renderTemplate(serviceConfig.AuthUser, data)
+		authPass := renderTemplate(serviceConfig.AuthPass, data)
+		req.SetBasicAuth(authUser, authPass)
+		pair := authUser + ":" + authPass
+		redactHAR(pair, base64.StdEncoding.EncodeToString([]byte(pair)))
+	}
+
+	if serviceConfig.AuthType == "sigv4" {
+		if err := signRequest(ctx, req, serviceConfig, data, payload); err != nil {
+			return nil, nil, fmt.Errorf("failed to sign request: %s", err.Error())
+		}
+	}
+
+	if serviceConfig.AuthType == "hmac" {
+		if err := signHMACRequest(req, serviceConfig, headerData); err != nil {
+			return nil, nil, fmt.Errorf("failed to sign request: %s", err.Error())
+		}
+	}
+
+	if !takeRequest() {
+		return nil, nil, errRequestBudget
+	}
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil && strings.Contains(err.Error(), "protocol version") {
+		return nil, nil, fmt.Errorf("request failed: %s can't negotiate tls %s or newer (-min-tls)", req.URL.Host, opts.minTLS)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("request failed: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readBody(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %s", err.Error())
+	}
+	return resp, respBody, nil
+}
+
+func multipartBody(serviceConfig ServiceConfig, data map[string]string) (string, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, name := range sortedKeys(serviceConfig.Form) {
+		if err := writer.WriteField(name, renderTemplate(serviceConfig.Form[name], data)); err != nil {
+			return "", "", err
+		}
+	}
+	if serviceConfig.FormFile != "" {
+		part, err := writer.CreateFormFile(serviceConfig.FormFile, "roq.txt")
+		if err != nil {
+			return "", "", err
+		}
+		part.Write([]byte("roq"))
+	}
+	if err := writer.Close(); err != nil {
+		return "", "", err
+	}
+	return buf.String(), writer.FormDataContentType(), nil
+}
+
+func signRequest(ctx context.Context, req *http.Request, serviceConfig ServiceConfig, data map[string]string, payload string) error {
+	region := serviceConfig.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	hash := sha256.Sum256([]byte(payload))
+	payloadHash := hex.EncodeToString(hash[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	creds := aws.Credentials{AccessKeyID: data["Key"], SecretAccessKey: data["Secret"]}
+	return v4.NewSigner().SignHTTP(ctx, creds, req, payloadHash, serviceConfig.Service, region, time.Now())
+}
+
+func signHMACRequest(req *http.Request, serviceConfig ServiceConfig, data map[string]string) error {
+	algorithm := strings.ToLower(serviceConfig.Algorithm)
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	hashFunc, ok := hmacAlgorithms[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported hmac algorithm: %s", algorithm)
+	}
+	if data["Secret"] == "" {
+		return fmt.Errorf("hmac signing requires a secret")
+	}
+	if serviceConfig.SignatureHeader == "" {
+		return fmt.Errorf("no signature_header configured")
+	}
+
+	mac := hmac.New(hashFunc, []byte(data["Secret"]))
+	mac.Write([]byte(renderTemplate(serviceConfig.SigningString, data)))
+	signature := hex.EncodeToString(mac.Sum(nil))
+	if serviceConfig.SignatureFormat == "base64" {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	data["Signature"] = signature
+	value := signature
+	if tmpl, ok := serviceConfig.Headers[serviceConfig.SignatureHeader]; ok {
+		value = renderTemplate(tmpl, data)
+	}
+	req.Header.Set(serviceConfig.SignatureHeader, value)
+	return nil
+}
+
+func evaluateResponse(serviceConfig ServiceConfig, statusCode int, body []byte, vars map[string]string, result VerificationResult) VerificationResult {
+	if !serviceConfig.SuccessStatus.Match(statusCode) {
+		result.Valid = false
+		result.Message = fmt.Sprintf("invalid (http %d)", statusCode)
+		result.explain("status_mismatch", "http %d is not in success_status %s", statusCode, serviceConfig.SuccessStatus)
+		return result
+	}
+
+	if len(serviceConfig.InvalidBodyContains) > 0 {
+		lowerBody := strings.ToLower(string(body))
+		for _, marker := range serviceConfig.InvalidBodyContains {
+			if marker != "" && strings.Contains(lowerBody, strings.ToLower(marker)) {
+				result.Valid = false
+				result.Message = fmt.Sprintf("invalid (response contains %q)", marker)
+				result.explain("invalid_body_marker", "http %d matched, but the body contains %q from invalid_body_contains", statusCode, marker)
+				return result
+			}
+		}
+	}
+
+	if serviceConfig.ResponseType == "xml" && (len(serviceConfig.ResponseFields) > 0 || serviceConfig.ErrorField != "") {
+		return evaluateXML(serviceConfig, statusCode, body, vars, result)
+	}
+
+	if serviceConfig.ItemsPath == "" && (serviceConfig.ResponseType != "json" || len(serviceConfig.ResponseFields) == 0) {
+		result.Valid = true
+		result.Message = "valid"
+		result.explain("status_match", "http %d matched success_status %s, no response fields to check", statusCode, serviceConfig.SuccessStatus)
+		if serviceConfig.DetailsFormat != "" {
+			var jsonResp map[string]interface{}
+			json.Unmarshal(body, &jsonResp)
+			result.Details = renderDetails(serviceConfig.DetailsFormat, flattenJSON(jsonResp), vars)
+		}
+		return result
+	}
+
+	var jsonResp map[string]interface{}
+	if err := json.Unmarshal(body, &jsonResp); err != nil {
+		result.Valid = false
+		result.Message = "invalid response format"
+		result.explain("invalid_response_format", "http %d matched, but the body is not a json object", statusCode)
+		return result
+	}
+
+	if serviceConfig.ErrorField != "" {
+		if errMsg, ok := jsonResp[serviceConfig.ErrorField].(string); ok && errMsg != "" {
+			result.Valid = false
+			result.Message = strings.ToLower(errMsg)
+			result.explain("error_field_present", "http %d matched, but error field %s is %q", statusCode, serviceConfig.ErrorField, errMsg)
+			return result
+		}
+		if value, exists := jsonResp[serviceConfig.ErrorField]; opts.strict && exists && value != nil {
+			result.Valid = false
+			result.Message = "invalid key (error field present)"
+			result.explain("error_field_present", "http %d matched, but error field %s is present (-strict)", statusCode, serviceConfig.ErrorField)
+			return result
+		}
+	}
+
+	if serviceConfig.StatusField != "" && len(serviceConfig.ActiveStatus) > 0 {
+		if status, ok := flattenJSON(jsonResp)[serviceConfig.StatusField]; ok && !containsFold(serviceConfig.ActiveStatus, status) {
 			result.Valid = false
-			result.Message = "key format valid but secret key required"
-			result.Details = "use: roq -s aws -k AKIA... -secret YOUR_SECRET_KEY"
+			result.Message = "credentials accepted but account is " + strings.ToLower(status)
+			result.explain("inactive_account", "http %d matched, but %s is %q, not one of %s", statusCode, serviceConfig.StatusField, status, strings.Join(serviceConfig.ActiveStatus, ", "))
+			if serviceConfig.DetailsFormat != "" {
+				result.Details = renderDetails(serviceConfig.DetailsFormat, flattenJSON(jsonResp), vars)
+			}
+			return result
+		}
+	}
+
+	if serviceConfig.SuccessField != "" {
+		if ok, exists := jsonResp[serviceConfig.SuccessField].(bool); exists && ok {
+			result.Valid = true
+			result.Message = "valid"
+			result.explain("success_field_true", "http %d matched and success field %s is true", statusCode, serviceConfig.SuccessField)
+			if serviceConfig.DetailsFormat != "" {
+				result.Details = renderDetails(serviceConfig.DetailsFormat, flattenJSON(jsonResp), vars)
+			}
 		} else {
 			result.Valid = false
-			result.Message = "invalid aws access key format"
+			result.Message = "invalid key"
+			result.explain("missing_success_field", "http %d matched, but success field %s is not true", statusCode, serviceConfig.SuccessField)
 		}
 		return result
 	}
 
-	ctx := context.Background()
+	flattened := flattenJSON(jsonResp)
+	if serviceConfig.ItemsPath != "" {
+		return evaluateItems(serviceConfig, statusCode, flattened, vars, result)
+	}
+	if hasResponseFields(serviceConfig.ResponseFields, flattened) {
+		result.Valid = true
+		result.Message = "valid"
+		result.explain("data_fields_present", "http %d matched and the response has %s", statusCode, strings.Join(presentFields(serviceConfig.ResponseFields, flattened), ", "))
+		if serviceConfig.DetailsFormat != "" {
+			result.Details = renderDetails(serviceConfig.DetailsFormat, flattened, vars)
+		}
+	} else {
+		result.Valid = false
+		result.Message = "invalid key"
+		result.explain("no_data_fields", "http %d matched, but %s", statusCode, describeMissing(serviceConfig.ResponseFields, flattened))
+	}
+	return result
+}
+
+func evaluateItems(serviceConfig ServiceConfig, statusCode int, flattened, vars map[string]string, result VerificationResult) VerificationResult {
+	count, ok := flattened[serviceConfig.ItemsPath+".#"]
+	if !ok {
+		result.Valid = false
+		result.Message = "invalid key"
+		result.explain("missing_items", "http %d matched, but %s is not a list in the response", statusCode, serviceConfig.ItemsPath)
+		return result
+	}
+	result.Valid = true
+	result.Message = "valid"
+	result.explain("items_listed", "http %d matched and %s lists %s items", statusCode, serviceConfig.ItemsPath, count)
+	if serviceConfig.DetailsFormat == "" {
+		result.Details = count + " items"
+		return result
+	}
+	data := make(map[string]string, len(vars)+1)
+	for k, v := range vars {
+		data[k] = v
+	}
+	data["Count"] = count
+	result.Details = renderDetails(serviceConfig.DetailsFormat, flattened, data)
+	return result
+}
+
+func presentFields(fields []string, flattened map[string]string) []string {
+	var present []string
+	for _, field := range fields {
+		if _, exists := flattened[field]; exists {
+			present = append(present, field)
+		}
+	}
+	return present
+}
+
+func describeMissing(fields []string, flattened map[string]string) string {
+	if !opts.strict {
+		return "the response has none of " + strings.Join(fields, ", ")
+	}
+	var missing []string
+	for _, field := range fields {
+		if _, exists := flattened[field]; !exists {
+			missing = append(missing, field)
+		}
+	}
+	return "the response is missing " + strings.Join(missing, ", ") + " (-strict)"
+}
+
+func hasResponseFields(fields []string, flattened map[string]string) bool {
+	if opts.strict {
+		for _, field := range fields {
+			if _, exists := flattened[field]; !exists {
+				return false
+			}
+		}
+		return len(fields) > 0
+	}
+	for _, field := range fields {
+		if _, exists := flattened[field]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func evaluateXML(serviceConfig ServiceConfig, statusCode int, body []byte, vars map[string]string, result VerificationResult) VerificationResult {
+	flattened, err := flattenXML(body)
+	if err != nil {
+		if opts.strict {
+			result.Valid = false
+			result.Message = "invalid response format"
+			result.explain("invalid_response_format", "http %d matched, but the body is not xml (-strict)", statusCode)
+			return result
+		}
+		result.Valid = true
+		result.Message = "valid"
+		result.explain("status_match", "http %d matched, the body is not xml so only the status counts", statusCode)
+		return result
+	}
+
+	if serviceConfig.ErrorField != "" {
+		if errMsg, exists := flattened[serviceConfig.ErrorField]; exists {
+			result.Valid = false
+			result.Message = strings.ToLower(errMsg)
+			if result.Message == "" {
+				result.Message = "invalid key"
+			}
+			result.explain("error_field_present", "http %d matched, but error element %s is present", statusCode, serviceConfig.ErrorField)
+			return result
+		}
+	}
+
+	if len(serviceConfig.ResponseFields) > 0 && !hasResponseFields(serviceConfig.ResponseFields, flattened) {
+		result.Valid = false
+		result.Message = "invalid key"
+		result.explain("no_data_fields", "http %d matched, but %s", statusCode, describeMissing(serviceConfig.ResponseFields, flattened))
+		return result
+	}
+
+	result.Valid = true
+	result.Message = "valid"
+	if len(serviceConfig.ResponseFields) > 0 {
+		result.explain("data_fields_present", "http %d matched and the response has %s", statusCode, strings.Join(presentFields(serviceConfig.ResponseFields, flattened), ", "))
+	} else {
+		result.explain("no_error_field", "http %d matched and error element %s is absent", statusCode, serviceConfig.ErrorField)
+	}
+	if serviceConfig.DetailsFormat != "" {
+		result.Details = renderDetails(serviceConfig.DetailsFormat, flattened, vars)
+	}
+	return result
+}
+
+func flattenXML(body []byte) (map[string]string, error) {
+	result := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	var stack []string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if _, exists := result[t.Name.Local]; !exists {
+				result[t.Name.Local] = ""
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if text != "" && len(stack) > 0 && result[stack[len(stack)-1]] == "" {
+				result[stack[len(stack)-1]] = text
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no xml elements found")
+	}
+	return result, nil
+}
+
+func extractScopes(serviceConfig ServiceConfig, header http.Header, body []byte) []string {
+	var raw interface{}
+	if serviceConfig.ScopesHeader != "" {
+		raw = header.Get(serviceConfig.ScopesHeader)
+	}
+	if serviceConfig.ScopesField != "" {
+		var jsonResp map[string]interface{}
+		if err := json.Unmarshal(body, &jsonResp); err == nil {
+			if value, ok := lookupJSON(jsonResp, serviceConfig.ScopesField); ok {
+				raw = value
+			}
+		}
+	}
+
+	var scopes []string
+	switch v := raw.(type) {
+	case string:
+		for _, scope := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			scopes = append(scopes, scope)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if scope, ok := item.(string); ok && scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+func extractExpiry(serviceConfig ServiceConfig, statusCode int, header http.Header, body []byte) string {
+	if !serviceConfig.SuccessStatus.Match(statusCode) {
+		return ""
+	}
+	expiry := ""
+	if serviceConfig.ExpiryHeader != "" {
+		expiry = header.Get(serviceConfig.ExpiryHeader)
+	}
+	if serviceConfig.ExpiryField != "" {
+		var jsonResp map[string]interface{}
+		if err := json.Unmarshal(body, &jsonResp); err == nil {
+			if value, ok := lookupJSON(jsonResp, serviceConfig.ExpiryField); ok {
+				if s, ok := value.(string); ok {
+					expiry = s
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(expiry)
+}
+
+func lookupJSON(data map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func verifyHMAC(serviceConfig ServiceConfig, key, secret string, result VerificationResult) VerificationResult {
+	algorithm := strings.ToLower(serviceConfig.Algorithm)
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	hashFunc, ok := hmacAlgorithms[algorithm]
+	if !ok {
+		result.Valid = false
+		result.Errored = true
+		result.Message = "unsupported hmac algorithm: " + algorithm
+		return result
+	}
+
+	data := templateData(key, secret)
+	payload := renderTemplate(serviceConfig.Payload, data)
+	expected := strings.TrimSpace(renderTemplate(serviceConfig.Signature, data))
+	if prefix, rest, found := strings.Cut(expected, "="); found && (hmacAlgorithms[prefix] != nil || prefix == "v1") {
+		expected = rest
+	}
+	if expected == "" {
+		result.Valid = false
+		result.Errored = true
+		result.Message = "no expected signature configured"
+		return result
+	}
+
+	mac := hmac.New(hashFunc, []byte(key))
+	mac.Write([]byte(payload))
+	sum := mac.Sum(nil)
+
+	if hmac.Equal([]byte(hex.EncodeToString(sum)), []byte(strings.ToLower(expected))) ||
+		hmac.Equal([]byte(base64.StdEncoding.EncodeToString(sum)), []byte(expected)) {
+		result.Valid = true
+		result.Message = "valid"
+		result.Details = "signature matches (hmac-" + algorithm + ")"
+		return result
+	}
+
+	result.Valid = false
+	result.Message = "signature mismatch"
+	return result
+}
+
+var templateFuncs = template.FuncMap{
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"contains":  strings.Contains,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"head":      headList,
+	"sha256":    sha256Hex,
+	"hmac":      hmacSHA256Hex,
+	"hex":       hexEncode,
+	"base64":    base64Encode,
+}
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func hexEncode(value string) string {
+	return hex.EncodeToString([]byte(value))
+}
+
+func base64Encode(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func hmacSHA256Hex(key, message string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func headList(n int, list string) string {
+	items := strings.Split(list, ", ")
+	if len(items) <= n {
+		return list
+	}
+	return strings.Join(items[:n], ", ") + fmt.Sprintf(", +%d more", len(items)-n)
+}
+
+func renderDetails(format string, flattened, vars map[string]string) string {
+	data := make(map[string]string, len(flattened)+len(vars))
+	for k, v := range vars {
+		data[k] = v
+	}
+	for k, v := range flattened {
+		data[k] = v
+	}
+	return renderTemplate(format, data)
+}
+
+func requestURL(serviceConfig ServiceConfig, data map[string]string) string {
+	rendered := renderTemplate(serviceConfig.URL, data)
+	if opts.instanceURL == nil {
+		return rendered
+	}
+	u, err := url.Parse(rendered)
+	if err != nil {
+		return rendered
+	}
+	u.Scheme = opts.instanceURL.Scheme
+	u.Host = opts.instanceURL.Host
+	u.Path = strings.TrimSuffix(opts.instanceURL.Path, "/") + u.Path
+	u.RawPath = ""
+	return u.String()
+}
+
+func templateData(key, secret string) map[string]string {
+	data := map[string]string{"Key": key, "Secret": secret, "Now": time.Now().UTC().Format(time.RFC3339), "UUID": uuid.NewString()}
+	for _, entry := range os.Environ() {
+		if name, value, ok := strings.Cut(entry, "="); ok && strings.HasPrefix(name, "ROQ_") {
+			data["Env."+name] = value
+		}
+	}
+	return data
+}
+
+func renderTemplate(tmpl string, data map[string]string) string {
+	t, err := template.New("tmpl").Funcs(templateFuncs).Parse(tmpl)
+	if err != nil {
+		return tmpl
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, templateContext(data)); err != nil {
+		return tmpl
+	}
+	return buf.String()
+}
+
+func templateContext(data map[string]string) map[string]interface{} {
+	context := map[string]interface{}{"Env": map[string]interface{}{}}
+	keys := make([]string, 0, len(data))
+	for key, value := range data {
+		context[key] = value
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) < len(keys[j]) })
+
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		node := context
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				if _, taken := node[part]; taken {
+					node = nil
+					break
+				}
+				child = make(map[string]interface{})
+				node[part] = child
+			}
+			node = child
+		}
+		if node == nil || len(parts) == 1 {
+			continue
+		}
+		if _, taken := node[parts[len(parts)-1]]; !taken {
+			node[parts[len(parts)-1]] = data[key]
+		}
+	}
+	return context
+}
+
+func flattenJSON(data map[string]interface{}) map[string]string {
+	result := make(map[string]string)
+	for key, value := range data {
+		flattenValue(key, value, result)
+	}
+	return result
+}
+
+func flattenValue(key string, value interface{}, result map[string]string) {
+	switch v := value.(type) {
+	case string:
+		result[key] = v
+	case map[string]interface{}:
+		for subKey, subValue := range v {
+			flattenValue(key+"."+subKey, subValue, result)
+		}
+	case []interface{}:
+		result[key] = fmt.Sprintf("%v", v)
+		result[key+".#"] = strconv.Itoa(len(v))
+		collected := make(map[string][]string)
+		var scalars []string
+		for _, item := range v {
+			switch item := item.(type) {
+			case map[string]interface{}:
+				for field, fieldValue := range flattenJSON(item) {
+					if !strings.Contains(field, "#") {
+						collected[field] = append(collected[field], fieldValue)
+					}
+				}
+			case nil, []interface{}:
+			default:
+				scalars = append(scalars, fmt.Sprintf("%v", item))
+			}
+		}
+		for field, values := range collected {
+			result[key+".*."+field] = strings.Join(values, ", ")
+		}
+		if len(scalars) > 0 {
+			result[key+".*"] = strings.Join(scalars, ", ")
+		}
+	case nil:
+	default:
+		result[key] = fmt.Sprintf("%v", v)
+	}
+}
+
+func verifyAWS(ctx context.Context, accessKey, secretKey string, result VerificationResult) VerificationResult {
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
 	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, opts.sessionToken)),
 		config.WithRegion("us-east-1"),
+		config.WithHTTPClient(sharedHTTPClient()),
 	)
 	if err != nil {
 		result.Valid = false
+		result.Errored = true
 		result.Message = "failed to create aws config: " + err.Error()
 		return result
 	}
 
-	resp, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.Retryer = aws.NopRetryer{}
+		if opts.stsEndpoint != "" {
+			o.BaseEndpoint = aws.String(opts.stsEndpoint)
+		}
+	})
+	result.Endpoint = "sts.amazonaws.com"
+	if opts.stsEndpoint != "" {
+		if u, err := url.Parse(opts.stsEndpoint); err == nil && u.Host != "" {
+			result.Endpoint = u.Host
+		}
+	}
+	if !takeRequest() {
+		return budgetSkipped(result)
+	}
+	resp, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil && isThrottleError(err) {
+		select {
+		case <-time.After(time.Second):
+			if !takeRequest() {
+				return budgetSkipped(result)
+			}
+			resp, err = client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		case <-ctx.Done():
+		}
+	}
 	if err != nil {
 		result.Valid = false
 		if strings.Contains(err.Error(), "InvalidClientTokenId") {
 			result.Message = "invalid credentials (access key not found)"
 		} else if strings.Contains(err.Error(), "SignatureDoesNotMatch") {
 			result.Message = "invalid credentials (incorrect secret key)"
+		} else if strings.Contains(err.Error(), "ExpiredToken") {
+			result.Message = "invalid credentials (session token expired)"
+		} else if strings.HasPrefix(accessKey, "ASIA") && opts.sessionToken == "" {
+			result.Message = "temporary credentials need -session-token"
 		} else {
+			result.Errored = true
 			result.Message = "verification failed: " + err.Error()
 		}
 		return result
@@ -475,9 +2208,50 @@ func verifyAWS(accessKey, secretKey string, result VerificationResult) Verificat
 	return result
 }
 
+func isThrottleError(err error) bool {
+	return retry.ThrottleErrorCode{Codes: retry.DefaultThrottleErrorCodes}.IsErrorThrottle(err) == aws.TrueTernary
+}
+
+func normalizeKey(key string, stripPrefix bool) string {
+	key = strings.TrimSpace(key)
+	for len(key) >= 2 && (key[0] == '"' || key[0] == '\'' || key[0] == '`') && key[len(key)-1] == key[0] {
+		key = strings.TrimSpace(key[1 : len(key)-1])
+	}
+	if stripPrefix {
+		for _, prefix := range []string{"bearer ", "token "} {
+			if len(key) > len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+				key = strings.TrimSpace(key[len(prefix):])
+				break
+			}
+		}
+	}
+	return key
+}
+
+func decodeKey(key, encoding string) (string, error) {
+	if encoding != "base64" {
+		return "", fmt.Errorf("unsupported key encoding: %s", encoding)
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := enc.DecodeString(key); err == nil {
+			return string(decoded), nil
+		}
+	}
+	return "", fmt.Errorf("key is not valid base64")
+}
+
+func keyID(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
 func maskKey(key string) string {
-	if len(key) <= 8 {
+	reveal := min(opts.maskReveal, len(key)/4)
+	if len(key) <= 8 || reveal <= 0 {
 		return "****"
 	}
-	return key[:4] + strings.Repeat("*", len(key)-8) + key[len(key)-4:]
+	return key[:reveal] + strings.Repeat("*", len(key)-2*reveal) + key[len(key)-reveal:]
 }
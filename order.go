@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var sortOrders = []string{"service", "validity", "severity", "latency"}
+
+func parseSortOrder(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, order := range sortOrders {
+		if value == order {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sort order %q (use %s)", value, strings.Join(sortOrders, ", "))
+}
+
+func sortResults(results []VerificationResult, order string) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch order {
+		case "validity":
+			if ra, rb := outcomeRanks[resultOutcome(a)], outcomeRanks[resultOutcome(b)]; ra != rb {
+				return ra < rb
+			}
+		case "severity":
+			if ra, rb := severityRank(a.Severity), severityRank(b.Severity); ra != rb {
+				return ra > rb
+			}
+		case "latency":
+			if a.LatencyMS != b.LatencyMS {
+				return a.LatencyMS > b.LatencyMS
+			}
+		}
+		return strings.ToLower(a.Service) < strings.ToLower(b.Service)
+	})
+}
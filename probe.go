@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type ProbeResult struct {
+	Variation string            `json:"variation"`
+	Method    string            `json:"method"`
+	Status    int               `json:"status,omitempty"`
+	Size      int               `json:"size"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type probeVariation struct {
+	name   string
+	config ServiceConfig
+	key    string
+	secret string
+}
+
+var probeHeaders = []string{"Content-Type", "WWW-Authenticate", "X-OAuth-Scopes", "X-RateLimit-Remaining", "RateLimit-Remaining", "Retry-After", "Location"}
+
+func runProbe(ctx context.Context) bool {
+	service := resolveService(opts.service)
+	serviceConfig, exists := servicesConfig.Services[service]
+	if !exists {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("unsupported service: "+service))
+		return false
+	}
+	serviceConfig = applyEnvironment(serviceConfig, opts.env)
+	if serviceConfig.VerifierCommand != "" || (serviceConfig.Method != http.MethodGet && serviceConfig.Method != http.MethodPost) {
+		fmt.Printf("%s %s\n", errorStyle.Render("✗"), dimStyle.Render("-probe only works with single get or post requests, "+service+" uses "+strings.ToLower(serviceConfig.Method)))
+		return false
+	}
+
+	key := normalizeKey(opts.key, serviceConfig.StripPrefix)
+	secret := normalizeKey(opts.secret, false)
+	redactCredentials(key, secret)
+
+	var results []ProbeResult
+	for _, variation := range probeVariations(serviceConfig, key, secret) {
+		result := ProbeResult{Variation: variation.name, Method: variation.config.Method}
+		resp, body, err := sendRequest(ctx, variation.config, templateData(variation.key, variation.secret))
+		if err != nil {
+			result.Error = redact(err.Error(), key, secret)
+			results = append(results, result)
+			continue
+		}
+		result.Status = resp.StatusCode
+		result.Size = len(body)
+		for _, name := range probeHeaders {
+			if value := resp.Header.Get(name); value != "" {
+				if result.Headers == nil {
+					result.Headers = make(map[string]string)
+				}
+				result.Headers[strings.ToLower(name)] = redact(value, key, secret)
+			}
+		}
+		results = append(results, result)
+	}
+
+	if opts.jsonOutput {
+		writeJSON(results)
+	} else {
+		displayProbe(service, results)
+	}
+	return true
+}
+
+func probeVariations(serviceConfig ServiceConfig, key, secret string) []probeVariation {
+	head := serviceConfig
+	head.Method = http.MethodHead
+	head.Body = ""
+	head.BodyType = ""
+	variations := []probeVariation{
+		{name: "configured", config: serviceConfig, key: key, secret: secret},
+		{name: "bogus key", config: serviceConfig, key: bogusKey(key), secret: secret},
+		{name: "no auth", config: withoutAuth(serviceConfig)},
+		{name: "head", config: head, key: key, secret: secret},
+	}
+	if serviceConfig.Method != http.MethodGet {
+		get := head
+		get.Method = http.MethodGet
+		variations = append(variations, probeVariation{name: "get", config: get, key: key, secret: secret})
+	}
+	return variations
+}
+
+func withoutAuth(serviceConfig ServiceConfig) ServiceConfig {
+	usesKey := func(value string) bool {
+		return strings.Contains(value, ".Key") || strings.Contains(value, ".Secret")
+	}
+	headers := make(map[string]string)
+	for name, value := range serviceConfig.Headers {
+		if !usesKey(value) {
+			headers[name] = value
+		}
+	}
+	cookies := make(map[string]string)
+	for name, value := range serviceConfig.Cookies {
+		if !usesKey(value) {
+			cookies[name] = value
+		}
+	}
+	serviceConfig.Headers = headers
+	serviceConfig.Cookies = cookies
+	serviceConfig.AuthType = ""
+	return serviceConfig
+}
+
+func bogusKey(key string) string {
+	start := strings.IndexAny(key, "_-")
+	if start < 0 || start > 8 {
+		start = -1
+	}
+	bogus := []byte(key)
+	for i := start + 1; i < len(bogus); i++ {
+		bogus[i] = rotateChar(bogus[i])
+	}
+	return string(bogus)
+}
+
+func rotateChar(c byte) byte {
+	for _, set := range []string{"0123456789", "abcdef", "ghijklmnopqrstuvwxyz", "ABCDEF", "GHIJKLMNOPQRSTUVWXYZ"} {
+		if i := strings.IndexByte(set, c); i >= 0 {
+			return set[(i+1)%len(set)]
+		}
+	}
+	return c
+}
+
+func displayProbe(service string, results []ProbeResult) {
+	width := len("variation")
+	for _, result := range results {
+		width = max(width, len(result.Variation))
+	}
+
+	fmt.Println()
+	fmt.Printf("%s %s\n", highlightStyle.Render("probe:"), dimStyle.Render(service))
+	fmt.Printf("  %s\n", dimStyle.Render(fmt.Sprintf("%-*s %-6s %-6s %-8s %s", width, "variation", "method", "status", "size", "headers")))
+	for _, result := range results {
+		method := fmt.Sprintf("%-6s", strings.ToLower(result.Method))
+		if result.Error != "" {
+			fmt.Printf("  %-*s %s %s\n", width, result.Variation, method, errorStyle.Render(result.Error))
+			continue
+		}
+		style := errorStyle
+		if result.Status < 400 {
+			style = successStyle
+		}
+		var headers []string
+		for _, name := range probeHeaders {
+			if value, ok := result.Headers[strings.ToLower(name)]; ok {
+				headers = append(headers, strings.ToLower(name)+": "+value)
+			}
+		}
+		fmt.Printf("  %-*s %s %s %-8s %s\n", width, result.Variation, method, style.Render(fmt.Sprintf("%-6d", result.Status)), fmt.Sprintf("%db", result.Size), dimStyle.Render(strings.Join(headers, " · ")))
+	}
+	if signal := probeSignal(results); signal != "" {
+		fmt.Println()
+		fmt.Printf("  %s\n", dimStyle.Render(signal))
+	}
+	fmt.Println()
+}
+
+func probeSignal(results []ProbeResult) string {
+	configured, bogus := results[0], results[1]
+	switch {
+	case configured.Error != "" || bogus.Error != "":
+		return ""
+	case configured.Status != bogus.Status:
+		return fmt.Sprintf("the status tells keys apart: %d for this key, %d for a bogus one", configured.Status, bogus.Status)
+	case configured.Size != bogus.Size:
+		return fmt.Sprintf("both get %d but the bodies differ, try response_fields, success_field or invalid_body_contains", configured.Status)
+	}
+	return "this key and a bogus one get the same response, the key may be invalid or the endpoint ignores it"
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+var unsavedFlags = map[string]bool{"k": true, "secret": true, "session-token": true, "profile": true, "save-profile": true}
+
+type profilesFile struct {
+	Profiles map[string]map[string]string `yaml:"profiles"`
+}
+
+func profilesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "roq", "profiles.yaml"), nil
+}
+
+func loadProfiles(path string) (profilesFile, error) {
+	var profiles profilesFile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return profiles, err
+	}
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return profiles, fmt.Errorf("failed to parse %s: %s", path, err.Error())
+	}
+	return profiles, nil
+}
+
+func applyProfile(name string) error {
+	path, err := profilesPath()
+	if err != nil {
+		return err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+	values, ok := profiles.Profiles[name]
+	if !ok {
+		return fmt.Errorf("no profile %q in %s", name, path)
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	names := make([]string, 0, len(values))
+	for flagName := range values {
+		names = append(names, flagName)
+	}
+	sort.Strings(names)
+	for _, flagName := range names {
+		if set[flagName] {
+			continue
+		}
+		if unsavedFlags[flagName] {
+			return fmt.Errorf("profile %q sets -%s, which profiles can't store", name, flagName)
+		}
+		if flag.Lookup(flagName) == nil {
+			return fmt.Errorf("profile %q sets unknown flag -%s", name, flagName)
+		}
+		if err := flag.Set(flagName, values[flagName]); err != nil {
+			return fmt.Errorf("profile %q: invalid -%s: %s", name, flagName, err.Error())
+		}
+	}
+	return nil
+}
+
+func saveProfile(name string) (string, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return "", err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return "", err
+	}
+
+	values := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if !unsavedFlags[f.Name] {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	if profiles.Profiles == nil {
+		profiles.Profiles = make(map[string]map[string]string)
+	}
+	profiles.Profiles[name] = values
+
+	data, err := yaml.Marshal(profiles)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, data, 0600)
+}
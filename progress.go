@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+const progressWidth = 24
+
+type batchProgress struct {
+	total   int
+	done    int
+	valid   int
+	invalid int
+	errored int
+}
+
+func newBatchProgress(total int) *batchProgress {
+	if opts.jsonOutput || total < 2 || !isTerminal(os.Stderr) || !isTerminal(os.Stdout) {
+		return nil
+	}
+	p := &batchProgress{total: total}
+	p.render()
+	return p
+}
+
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+func (p *batchProgress) clear() {
+	if p != nil {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
+
+func (p *batchProgress) add(result VerificationResult) {
+	if p == nil {
+		return
+	}
+	p.done++
+	switch {
+	case result.Valid:
+		p.valid++
+	case result.Errored:
+		p.errored++
+	case !result.Skipped:
+		p.invalid++
+	}
+	p.render()
+}
+
+func (p *batchProgress) render() {
+	filled := progressWidth * p.done / p.total
+	bar := successStyle.Render(strings.Repeat("█", filled)) + dimStyle.Render(strings.Repeat("░", progressWidth-filled))
+	tally := fmt.Sprintf("%d/%d", p.done, p.total)
+	fmt.Fprintf(os.Stderr, "\r%s %s %s %s %s", bar, highlightStyle.Render(tally),
+		successStyle.Render(fmt.Sprintf("%d valid", p.valid)),
+		dimStyle.Render(fmt.Sprintf("%d invalid", p.invalid)),
+		errorStyle.Render(fmt.Sprintf("%d errored", p.errored)))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string            `json:"id"`
+	Name                 string            `json:"name"`
+	ShortDescription     sarifMessage      `json:"shortDescription"`
+	DefaultConfiguration sarifLevel        `json:"defaultConfiguration"`
+	Properties           map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLevel struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+var sarifSecuritySeverity = map[string]string{"critical": "9.5", "high": "8.0", "medium": "5.5", "low": "3.0"}
+
+func sarifLevelFor(severity string) string {
+	switch severity {
+	case "medium":
+		return "warning"
+	case "low":
+		return "note"
+	}
+	return "error"
+}
+
+func buildSARIF(results []VerificationResult) sarifLog {
+	rules := make(map[string]sarifRule)
+	ranks := make(map[string]int)
+	findings := []sarifResult{}
+	for _, result := range results {
+		if !result.Valid || !meetsSeverity(result) {
+			continue
+		}
+		service := strings.ToLower(result.Service)
+		rule, ok := rules[service]
+		if !ok {
+			rule = sarifRule{
+				ID:                   service,
+				Name:                 service,
+				ShortDescription:     sarifMessage{Text: "valid " + result.Service + " credential"},
+				DefaultConfiguration: sarifLevel{Level: sarifLevelFor(result.Severity)},
+			}
+		}
+		if severityRank(result.Severity) > ranks[service] {
+			ranks[service] = severityRank(result.Severity)
+			rule.Properties = map[string]string{"security-severity": sarifSecuritySeverity[result.Severity]}
+			rule.DefaultConfiguration.Level = sarifLevelFor(result.Severity)
+		}
+		rules[service] = rule
+
+		text := "valid " + service + " key " + result.Key
+		if result.Details != "" {
+			text += " (" + strings.ToLower(result.Details) + ")"
+		}
+		finding := sarifResult{
+			RuleID:    service,
+			Level:     sarifLevelFor(result.Severity),
+			Message:   sarifMessage{Text: text},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifact{URI: result.Key}}}},
+		}
+		if result.ID != "" {
+			finding.PartialFingerprints = map[string]string{"roqKeyId/v1": service + ":" + result.ID}
+		}
+		findings = append(findings, finding)
+	}
+
+	driver := sarifDriver{Name: "roq", Version: version, InformationURI: "https://github.com/1hehaq/roq", Rules: []sarifRule{}}
+	for _, name := range sortedRuleIDs(rules) {
+		driver.Rules = append(driver.Rules, rules[name])
+	}
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: findings}},
+	}
+}
+
+func sortedRuleIDs(rules map[string]sarifRule) []string {
+	ids := make([]string, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func writeSARIF(path string, results []VerificationResult) error {
+	data, err := json.MarshalIndent(buildSARIF(results), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
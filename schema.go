@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const servicesSchemaURL = "https://raw.githubusercontent.com/1hehaq/roq/main/services.schema.json"
+
+//go:embed services.schema.json
+var servicesSchemaJSON string
+
+var (
+	servicesSchema     *jsonschema.Schema
+	servicesSchemaOnce sync.Once
+)
+
+func compiledSchema() *jsonschema.Schema {
+	servicesSchemaOnce.Do(func() {
+		compiler := jsonschema.NewCompiler()
+		compiler.AssertFormat = true
+		if err := compiler.AddResource(servicesSchemaURL, strings.NewReader(servicesSchemaJSON)); err != nil {
+			panic(err)
+		}
+		servicesSchema = compiler.MustCompile(servicesSchemaURL)
+	})
+	return servicesSchema
+}
+
+type schemaProblem struct {
+	line int
+	text string
+}
+
+func validateServicesSchema(data []byte) ([]string, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := root.Decode(&doc); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var instance interface{}
+	if err := json.Unmarshal(encoded, &instance); err != nil {
+		return nil, err
+	}
+
+	var problems []schemaProblem
+	seen := make(map[string]bool)
+	if err := compiledSchema().Validate(instance); err != nil {
+		verr, ok := err.(*jsonschema.ValidationError)
+		if !ok {
+			return nil, err
+		}
+		collectSchemaErrors(verr, &root, &problems, seen)
+	}
+	collectStrictErrors(data, &problems)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].line != problems[j].line {
+			return problems[i].line < problems[j].line
+		}
+		return problems[i].text < problems[j].text
+	})
+	var lines []string
+	for _, problem := range problems {
+		if problem.line > 0 {
+			lines = append(lines, fmt.Sprintf("line %d: %s", problem.line, problem.text))
+		} else {
+			lines = append(lines, problem.text)
+		}
+	}
+	return lines, nil
+}
+
+var schemaHints = map[string]string{
+	"success_status": "must be a status code, range (200-299) or class (2xx), or a list of them",
+	"timeout":        "must be a duration like 30s",
+}
+
+var quotedNames = regexp.MustCompile(`'([^']*)'`)
+
+func collectSchemaErrors(verr *jsonschema.ValidationError, root *yaml.Node, problems *[]schemaProblem, seen map[string]bool) {
+	line := schemaLine(root, verr.InstanceLocation)
+	if strings.HasSuffix(verr.KeywordLocation, "/anyOf") || strings.HasSuffix(verr.KeywordLocation, "/oneOf") {
+		if hint, ok := schemaHints[schemaField(verr.InstanceLocation)]; ok {
+			addSchemaProblem(line, schemaPath(verr.InstanceLocation)+" "+hint, problems, seen)
+			return
+		}
+	}
+	if len(verr.Causes) > 0 {
+		for _, cause := range verr.Causes {
+			collectSchemaErrors(cause, root, problems, seen)
+		}
+		return
+	}
+
+	path := schemaPath(verr.InstanceLocation)
+	switch {
+	case strings.HasPrefix(verr.Message, "additionalProperties "):
+		for _, match := range quotedNames.FindAllStringSubmatch(verr.Message, -1) {
+			addSchemaProblem(schemaLine(root, verr.InstanceLocation+"/"+match[1]), path+": unknown field "+match[1], problems, seen)
+		}
+	case strings.HasPrefix(verr.Message, "missing properties: "):
+		for _, match := range quotedNames.FindAllStringSubmatch(verr.Message, -1) {
+			addSchemaProblem(line, path+": missing required field "+match[1], problems, seen)
+		}
+	default:
+		problem := path + ": " + verr.Message
+		if message, ok := strings.CutPrefix(verr.Message, "value "); ok {
+			problem = path + " " + message
+		}
+		addSchemaProblem(line, problem, problems, seen)
+	}
+}
+
+func collectStrictErrors(data []byte, problems *[]schemaProblem) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var config ServicesConfig
+	terr, ok := decoder.Decode(&config).(*yaml.TypeError)
+	if !ok {
+		return
+	}
+	reported := make(map[int]bool)
+	for _, problem := range *problems {
+		reported[problem.line] = true
+	}
+	for _, message := range terr.Errors {
+		var line int
+		if _, err := fmt.Sscanf(message, "line %d:", &line); err != nil || reported[line] {
+			continue
+		}
+		text := strings.TrimSpace(message[strings.Index(message, ":")+1:])
+		text = strings.Replace(text, " in type main.", " in ", 1)
+		*problems = append(*problems, schemaProblem{line: line, text: text})
+	}
+}
+
+func addSchemaProblem(line int, text string, problems *[]schemaProblem, seen map[string]bool) {
+	if !seen[text] {
+		seen[text] = true
+		*problems = append(*problems, schemaProblem{line: line, text: text})
+	}
+}
+
+func schemaLine(root *yaml.Node, pointer string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	if pointer == "" {
+		return line
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == part {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if index, err := strconv.Atoi(part); err == nil && index < len(node.Content) {
+				next = node.Content[index]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			return line
+		}
+		node = next
+	}
+	return line
+}
+
+func schemaField(pointer string) string {
+	parts := strings.Split(pointer, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if _, err := strconv.Atoi(parts[i]); err != nil {
+			return parts[i]
+		}
+	}
+	return ""
+}
+
+func schemaPath(pointer string) string {
+	if pointer == "" {
+		return "config"
+	}
+	parts := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, part := range parts {
+		parts[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+func schemaError(problems []string) error {
+	if len(problems) == 1 {
+		return fmt.Errorf("invalid services config: %s", problems[0])
+	}
+	return fmt.Errorf("invalid services config: %s (and %d more, see -validate-config)", problems[0], len(problems)-1)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+type secretResolver func(ctx context.Context, ref string) (string, error)
+
+var secretResolvers = map[string]secretResolver{
+	"env":            resolveEnvSecret,
+	"secretsmanager": resolveSecretsManager,
+}
+
+func resolveSecret(ctx context.Context, value string) (string, error) {
+	scheme, ref, found := strings.Cut(value, ":")
+	if !found {
+		return value, nil
+	}
+	resolver, ok := secretResolvers[scheme]
+	if !ok {
+		return value, nil
+	}
+	resolved, err := resolver(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", scheme, err)
+	}
+	return resolved, nil
+}
+
+func resolveSecretFlags(ctx context.Context) error {
+	for i, secret := range opts.secrets {
+		resolved, err := resolveSecret(ctx, secret)
+		if err != nil {
+			return err
+		}
+		opts.secrets[i] = resolved
+		redactHAR(resolved)
+	}
+	if len(opts.secrets) > 0 {
+		opts.secret = opts.secrets[0]
+	}
+	return nil
+}
+
+func resolveEnvSecret(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func resolveSecretsManager(ctx context.Context, ref string) (string, error) {
+	secretID, field, _ := strings.Cut(ref, "#")
+	if secretID == "" {
+		return "", fmt.Errorf("expected secretsmanager:<secret-id>[#field]")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	region := cfg.Region
+	if parts := strings.Split(secretID, ":"); len(parts) > 4 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("no aws credentials to read the secret: %w", err)
+	}
+
+	payload, _ := json.Marshal(map[string]string{"SecretId": secretID})
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://secretsmanager."+region+".amazonaws.com/", strings.NewReader(string(payload)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	hash := sha256.Sum256(payload)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "secretsmanager", region, time.Now()); err != nil {
+		return "", err
+	}
+
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := readBody(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("unexpected response (http %d)", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		errType := out.Type[strings.LastIndex(out.Type, "#")+1:]
+		return "", fmt.Errorf("%s: %s", errType, out.Message)
+	}
+	if field == "" {
+		return out.SecretString, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(out.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a json object, cannot read field %s", secretID, field)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", secretID, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var severityLevels = []string{"low", "medium", "high", "critical"}
+
+func severityRank(severity string) int {
+	for i, level := range severityLevels {
+		if strings.EqualFold(level, severity) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func parseSeverity(value string) (string, error) {
+	if severityRank(value) == 0 {
+		return "", fmt.Errorf("unknown severity %q (use %s)", value, strings.Join(severityLevels, ", "))
+	}
+	return strings.ToLower(value), nil
+}
+
+func rateSeverity(serviceConfig ServiceConfig, result VerificationResult) VerificationResult {
+	rank := severityRank(serviceConfig.Severity)
+	if !result.Valid || rank == 0 {
+		return result
+	}
+	if strings.EqualFold(result.Mode, "test") {
+		rank--
+	}
+	if hasPrivilegedScope(result.Scopes) {
+		rank++
+	}
+	rank = max(1, min(rank, len(severityLevels)))
+	result.Severity = severityLevels[rank-1]
+	return result
+}
+
+func hasPrivilegedScope(scopes []string) bool {
+	for _, scope := range scopes {
+		scope = strings.ToLower(scope)
+		if strings.Contains(scope, "admin") || strings.Contains(scope, "write") || strings.Contains(scope, "delete") {
+			return true
+		}
+	}
+	return false
+}
+
+func meetsSeverity(result VerificationResult) bool {
+	if opts.minSeverity == "" {
+		return true
+	}
+	return severityRank(result.Severity) >= severityRank(opts.minSeverity)
+}
+
+func severityStyle(severity string) lipgloss.Style {
+	switch severity {
+	case "critical":
+		return errorStyle
+	case "high":
+		return warnStyle.Bold(true)
+	case "medium":
+		return warnStyle
+	}
+	return dimStyle
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type statusRange struct {
+	min int
+	max int
+}
+
+type StatusMatcher []statusRange
+
+func (m *StatusMatcher) UnmarshalYAML(value *yaml.Node) error {
+	var specs []string
+	switch value.Kind {
+	case yaml.ScalarNode:
+		specs = []string{value.Value}
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: invalid success_status entry", item.Line)
+			}
+			specs = append(specs, item.Value)
+		}
+	default:
+		return fmt.Errorf("line %d: success_status must be a code, range or list", value.Line)
+	}
+
+	matcher := make(StatusMatcher, 0, len(specs))
+	for _, spec := range specs {
+		r, err := parseStatusRange(spec)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", value.Line, err)
+		}
+		matcher = append(matcher, r)
+	}
+	*m = matcher
+	return nil
+}
+
+func (m StatusMatcher) MarshalYAML() (interface{}, error) {
+	return m.String(), nil
+}
+
+func parseStatusRange(spec string) (statusRange, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+
+	if len(spec) == 3 && strings.HasSuffix(spec, "xx") {
+		class, err := strconv.Atoi(spec[:1])
+		if err != nil || class < 1 || class > 5 {
+			return statusRange{}, fmt.Errorf("invalid status class %q", spec)
+		}
+		return statusRange{min: class * 100, max: class*100 + 99}, nil
+	}
+
+	if lo, hi, found := strings.Cut(spec, "-"); found {
+		min, errMin := strconv.Atoi(strings.TrimSpace(lo))
+		max, errMax := strconv.Atoi(strings.TrimSpace(hi))
+		if errMin != nil || errMax != nil || min > max {
+			return statusRange{}, fmt.Errorf("invalid status range %q", spec)
+		}
+		return statusRange{min: min, max: max}, nil
+	}
+
+	code, err := strconv.Atoi(spec)
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid status code %q", spec)
+	}
+	return statusRange{min: code, max: code}, nil
+}
+
+func (m StatusMatcher) Match(code int) bool {
+	for _, r := range m {
+		if code >= r.min && code <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+func (m StatusMatcher) String() string {
+	parts := make([]string, 0, len(m))
+	for _, r := range m {
+		switch {
+		case r.min == r.max:
+			parts = append(parts, strconv.Itoa(r.min))
+		case r.min%100 == 0 && r.max == r.min+99:
+			parts = append(parts, fmt.Sprintf("%dxx", r.min/100))
+		default:
+			parts = append(parts, fmt.Sprintf("%d-%d", r.min, r.max))
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    statusRange
+		wantErr bool
+	}{
+		{spec: "2xx", want: statusRange{min: 200, max: 299}},
+		{spec: "4XX", want: statusRange{min: 400, max: 499}},
+		{spec: "200-204", want: statusRange{min: 200, max: 204}},
+		{spec: " 200 - 204 ", want: statusRange{min: 200, max: 204}},
+		{spec: "201", want: statusRange{min: 201, max: 201}},
+		{spec: "6xx", wantErr: true},
+		{spec: "axx", wantErr: true},
+		{spec: "204-200", wantErr: true},
+		{spec: "200-", wantErr: true},
+		{spec: "ok", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseStatusRange(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseStatusRange(%q) = %v, want error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseStatusRange(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseStatusRange(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestStatusMatcher(t *testing.T) {
+	tests := []struct {
+		yaml     string
+		match    []int
+		mismatch []int
+		str      string
+	}{
+		{yaml: `"2xx"`, match: []int{200, 201, 299}, mismatch: []int{199, 300, 401}, str: "2xx"},
+		{yaml: `"200-204"`, match: []int{200, 204}, mismatch: []int{205, 199}, str: "200-204"},
+		{yaml: `201`, match: []int{201}, mismatch: []int{200, 202}, str: "201"},
+		{yaml: `[200, "3xx", "401-403"]`, match: []int{200, 302, 403}, mismatch: []int{201, 400, 404}, str: "200,3xx,401-403"},
+	}
+	for _, tt := range tests {
+		var matcher StatusMatcher
+		if err := yaml.Unmarshal([]byte(tt.yaml), &matcher); err != nil {
+			t.Errorf("unmarshal %s: %v", tt.yaml, err)
+			continue
+		}
+		for _, code := range tt.match {
+			if !matcher.Match(code) {
+				t.Errorf("%s does not match %d", tt.yaml, code)
+			}
+		}
+		for _, code := range tt.mismatch {
+			if matcher.Match(code) {
+				t.Errorf("%s matches %d", tt.yaml, code)
+			}
+		}
+		if got := matcher.String(); got != tt.str {
+			t.Errorf("%s String() = %q, want %q", tt.yaml, got, tt.str)
+		}
+	}
+}
+
+func TestStatusMatcherInvalid(t *testing.T) {
+	for _, spec := range []string{`"abc"`, `"7xx"`, `["200", "x"]`, `{code: 200}`, `[[200]]`} {
+		var matcher StatusMatcher
+		if err := yaml.Unmarshal([]byte(spec), &matcher); err == nil {
+			t.Errorf("unmarshal %s = %v, want error", spec, matcher)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var (
+	sharedClient     *http.Client
+	sharedClientOnce sync.Once
+	requestCount     atomic.Int64
+)
+
+var (
+	errRequestBudget = errors.New("request budget exhausted (-max-requests)")
+	errPlaintext     = errors.New("refusing to send the key over plaintext http, use -insecure-allow-plaintext to allow it")
+	plaintextWarned  sync.Map
+)
+
+func checkPlaintext(u *url.URL) error {
+	if u.Scheme != "http" || isLoopback(u.Hostname()) {
+		return nil
+	}
+	if !opts.plaintext {
+		return errPlaintext
+	}
+	if _, warned := plaintextWarned.LoadOrStore(u.Host, true); !warned {
+		log.Warn("Sending key over plaintext http", "host", u.Host)
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func takeRequest() bool {
+	return opts.maxRequests <= 0 || requestCount.Add(1) <= opts.maxRequests
+}
+
+func budgetSkipped(result VerificationResult) VerificationResult {
+	result.Valid = false
+	result.Skipped = true
+	result.Message = "skipped: " + errRequestBudget.Error()
+	result.ReasonCode = "request_budget"
+	return result
+}
+
+func requestBudgetSpent() bool {
+	return opts.maxRequests > 0 && requestCount.Load() > opts.maxRequests
+}
+
+func sharedHTTPClient() *http.Client {
+	sharedClientOnce.Do(func() {
+		sharedClient = newHTTPClient()
+		sharedClient.Timeout = 0
+		transport := sharedClient.Transport.(*http.Transport)
+		transport.MaxIdleConns = max(100, opts.concurrency*2)
+		transport.MaxIdleConnsPerHost = opts.concurrency
+		if opts.maxIdleConns > 0 {
+			transport.MaxIdleConns = max(transport.MaxIdleConns, opts.maxIdleConns)
+			transport.MaxIdleConnsPerHost = opts.maxIdleConns
+		}
+		transport.IdleConnTimeout = 90 * time.Second
+		sharedClient.Transport = harTransport(transport)
+	})
+	return sharedClient
+}
+
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tunnel != nil {
+		transport.DialContext = tunnelDial
+	} else if opts.resolver != "" || opts.preferIPv6 || opts.ipVersion != "auto" {
+		transport.DialContext = dialContext
+	}
+	transport.TLSClientConfig = &tls.Config{ServerName: opts.sni, MinVersion: minTLSVersion()}
+	transport.DisableKeepAlives = opts.noKeepalive
+	if !opts.http2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{Timeout: opts.timeout, Transport: transport}
+}
+
+func minTLSVersion() uint16 {
+	if opts.minTLS == "1.3" {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch opts.ipVersion {
+	case "4":
+		network = "tcp4"
+	case "6":
+		network = "tcp6"
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	resolver := net.DefaultResolver
+	if opts.resolver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, network, opts.resolver)
+			},
+		}
+		dialer.Resolver = resolver
+	}
+	if !opts.preferIPv6 || opts.ipVersion != "auto" {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		return ips[i].IP.To4() == nil && ips[j].IP.To4() != nil
+	})
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func readBody(r io.Reader) ([]byte, error) {
+	if opts.maxBody <= 0 {
+		return io.ReadAll(r)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, opts.maxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > opts.maxBody {
+		log.Debug("Response cut off at -max-body", "limit", opts.maxBody)
+		return nil, fmt.Errorf("response larger than %d bytes (-max-body)", opts.maxBody)
+	}
+	return body, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestReadBodyLimit(t *testing.T) {
+	defer func(saved options) { opts = saved }(opts)
+	opts.maxBody = 1024
+
+	body, err := readBody(strings.NewReader(strings.Repeat("a", 1024)))
+	if err != nil || len(body) != 1024 {
+		t.Fatalf("readBody at the limit = %d bytes, %v", len(body), err)
+	}
+
+	src := &countingReader{r: strings.NewReader(strings.Repeat("a", 1<<20))}
+	body, err = readBody(src)
+	if err == nil || body != nil {
+		t.Fatalf("readBody over the limit = %d bytes, %v, want error", len(body), err)
+	}
+	if src.n != opts.maxBody+1 {
+		t.Errorf("readBody read %d bytes, want it to stop at %d", src.n, opts.maxBody+1)
+	}
+}
+
+func TestMaxBodyResult(t *testing.T) {
+	defer func(saved options) { opts = saved }(opts)
+	opts.maxBody = 1024
+	opts.timeout = 5 * time.Second
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"login":"` + strings.Repeat("a", 1<<20) + `"}`))
+	}))
+	defer srv.Close()
+
+	servicesConfig.Services["maxbodytest"] = ServiceConfig{
+		Name:           "MaxBodyTest",
+		Method:         "GET",
+		URL:            srv.URL,
+		SuccessStatus:  StatusMatcher{{min: 200, max: 200}},
+		ResponseType:   "json",
+		ResponseFields: []string{"login"},
+	}
+	defer delete(servicesConfig.Services, "maxbodytest")
+
+	result := verifyAPIKey(context.Background(), "maxbodytest", "test-key-0123456789", "")
+	if result.Valid || !result.Errored {
+		t.Fatalf("valid=%v errored=%v, want an errored result", result.Valid, result.Errored)
+	}
+	if result.ReasonCode != "request_failed" {
+		t.Errorf("reason_code = %q, want request_failed", result.ReasonCode)
+	}
+	if want := "response larger than 1024 bytes (-max-body)"; !strings.Contains(result.Message, want) {
+		t.Errorf("message = %q, want it to contain %q", result.Message, want)
+	}
+}
+
+func TestEnrichInvalidJSON(t *testing.T) {
+	defer func(saved options) { opts = saved }(opts)
+	opts.enrich = true
+	opts.timeout = 5 * time.Second
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			w.Write([]byte("<html>not json</html>"))
+			return
+		}
+		w.Write([]byte(`{"login":"x"}`))
+	}))
+	defer srv.Close()
+
+	servicesConfig.Services["enrichtest"] = ServiceConfig{
+		Name:          "EnrichTest",
+		Method:        "GET",
+		URL:           srv.URL,
+		SuccessStatus: StatusMatcher{{min: 200, max: 200}},
+		Enrich: []ServiceConfig{{
+			Method:        "GET",
+			URL:           srv.URL + "/models",
+			SuccessStatus: StatusMatcher{{min: 200, max: 200}},
+			ResponseType:  "json",
+			DetailsFormat: "models: {{.Count}}",
+		}},
+	}
+	defer delete(servicesConfig.Services, "enrichtest")
+
+	result := verifyAPIKey(context.Background(), "enrichtest", "test-key-0123456789", "")
+	if !result.Valid {
+		t.Fatalf("valid=false (%s), want the key to stay valid", result.Message)
+	}
+	if result.Details != "" {
+		t.Errorf("details = %q, want none from the broken enrich step", result.Details)
+	}
+	if want := "enrich step 1: invalid response format"; result.Warning != want {
+		t.Errorf("warning = %q, want %q", result.Warning, want)
+	}
+}
+
+func TestBuiltinPlaintextServicesHaveNote(t *testing.T) {
+	data, err := servicesYAML.ReadFile("services.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := decodeServices(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var check func(name, note string, service ServiceConfig)
+	check = func(name, note string, service ServiceConfig) {
+		if service.PlaintextNote != "" {
+			note = service.PlaintextNote
+		}
+		if strings.HasPrefix(strings.ToLower(service.URL), "http://") && note == "" {
+			t.Errorf("%s: %s is plain http without a plaintext_note", name, service.URL)
+		}
+		for _, step := range append(service.Steps, service.Enrich...) {
+			check(name, note, step)
+		}
+		for _, env := range service.Environments {
+			check(name, note, env)
+		}
+	}
+	for name, service := range config.Services {
+		check(name, "", service)
+	}
+}
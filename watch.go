@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func runWatch() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(opts.watch)
+	defer ticker.Stop()
+
+	if !opts.jsonOutput {
+		fmt.Println()
+		fmt.Printf("%s %s\n", highlightStyle.Render("watching"), dimStyle.Render(fmt.Sprintf("%s every %s (ctrl-c to stop)", strings.ToLower(opts.service), opts.watch)))
+	}
+
+	checked := false
+	lastValid := false
+	for ctx.Err() == nil {
+		result := verifyAPIKey(ctx, opts.service, opts.key, opts.secret)
+		if ctx.Err() != nil {
+			break
+		}
+		recordResult(result, opts.key)
+
+		changed := !checked || result.Valid != lastValid
+		if changed || opts.watchVerbose {
+			if opts.jsonOutput {
+				writeJSON(result)
+			} else {
+				displayWatchResult(result, checked && changed)
+			}
+		}
+		if checked && changed && opts.webhook != "" {
+			if err := postWebhook(ctx, result); err != nil {
+				log.Warn("Webhook failed", "url", opts.webhook, "error", err)
+			}
+		}
+		checked = true
+		lastValid = result.Valid
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	if !opts.jsonOutput {
+		fmt.Println()
+	}
+}
+
+func postWebhook(ctx context.Context, result VerificationResult) error {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", opts.webhook, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	if !takeRequest() {
+		return errRequestBudget
+	}
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("http %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func displayWatchResult(result VerificationResult, changed bool) {
+	if opts.formatTmpl != nil {
+		displayFormatted(result)
+		return
+	}
+	mark := errorStyle.Render("✗")
+	info := result.Message
+	if result.Valid {
+		mark = successStyle.Render("✓")
+		info = result.Details
+		if info == "" {
+			info = result.Message
+		}
+	}
+
+	line := fmt.Sprintf("%s %s %s", dimStyle.Render(time.Now().Format("15:04:05")), mark, strings.ToLower(result.Service))
+	if info != "" {
+		line += " " + dimStyle.Render(strings.ToLower(info))
+	}
+	if changed {
+		line += " " + highlightStyle.Render("(changed)")
+	}
+	fmt.Println(line)
+}